@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name = 'users:write';
+DROP TABLE IF EXISTS login_throttles;
@@ -0,0 +1,16 @@
+-- One row per alert rule and group. Lets the alerting engine suppress repeat
+-- notifications across restarts and backend instances.
+CREATE TABLE IF NOT EXISTS alert_states (
+    rule VARCHAR(255) NOT NULL,
+    group_key TEXT NOT NULL,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    severity VARCHAR(32) NOT NULL,
+    event_count INTEGER NOT NULL,
+    fire_count INTEGER NOT NULL DEFAULT 1,
+    suppressed_count INTEGER NOT NULL DEFAULT 0,
+    fired_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (rule, group_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_states_org_id ON alert_states(org_id);
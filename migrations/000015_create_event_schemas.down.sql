@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name = 'schemas:manage';
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS event_validation;
+
+DROP TABLE IF EXISTS event_schemas;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS event_schemas (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    event_name VARCHAR(128) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    properties JSONB NOT NULL DEFAULT '{}',
+    allow_additional_properties BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, event_name)
+);
+
+-- off accepts every event, reject refuses invalid ones and quarantine stores
+-- them apart from analytics_events
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS event_validation VARCHAR(16) NOT NULL DEFAULT 'off';
+
+INSERT INTO permissions (name, description) VALUES
+('schemas:manage', 'Manage analytics event schemas and validation')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'schemas:manage'
+ON CONFLICT DO NOTHING;
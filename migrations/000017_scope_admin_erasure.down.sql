@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS platform_operator;
+
+ALTER TABLE data_requests DROP COLUMN IF EXISTS organization_id;
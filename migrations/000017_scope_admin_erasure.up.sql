@@ -0,0 +1,6 @@
+-- Admin erasures only cover the admin's organization
+ALTER TABLE data_requests ADD COLUMN IF NOT EXISTS organization_id INTEGER;
+
+-- Platform operators may erase any account. The flag is only ever set
+-- directly in the database, never through the API.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS platform_operator BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,10 @@
+-- API keys with this scope may send events to the analytics service for
+-- their organization
+INSERT INTO permissions (name, description) VALUES
+('events:write', 'Send analytics events with an API key')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'events:write'
+ON CONFLICT DO NOTHING;
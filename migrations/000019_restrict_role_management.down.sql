@@ -0,0 +1,8 @@
+INSERT INTO permissions (name, description) VALUES
+('roles:write', 'Create, update and delete role definitions')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'roles:write'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- Role definitions are shared by every organization and are managed by
+-- platform operators only
+DELETE FROM permissions WHERE name = 'roles:write';
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS analytics_events (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    event String,
+    metadata String,
+    properties Map(String, String)
+)
+ENGINE = MergeTree()
+ORDER BY (timestamp, user_id);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    action String,
+    resource String,
+    resource_id String,
+    details String,
+    ip_address String,
+    user_agent String
+)
+ENGINE = MergeTree()
+ORDER BY (timestamp, user_id);
+
+-- Tables created before multi-tenancy lack the org_id column
+ALTER TABLE analytics_events ADD COLUMN IF NOT EXISTS org_id UInt64 AFTER timestamp;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS org_id UInt64 AFTER timestamp;
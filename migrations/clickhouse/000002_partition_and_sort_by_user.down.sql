@@ -0,0 +1,44 @@
+DROP TABLE IF EXISTS analytics_events_rebuild;
+
+CREATE TABLE analytics_events_rebuild (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    event String,
+    metadata String,
+    properties Map(String, String)
+)
+ENGINE = MergeTree()
+ORDER BY (timestamp, user_id);
+
+INSERT INTO analytics_events_rebuild (id, timestamp, org_id, user_id, event, metadata, properties)
+SELECT id, timestamp, org_id, user_id, event, metadata, properties FROM analytics_events;
+
+EXCHANGE TABLES analytics_events AND analytics_events_rebuild;
+
+DROP TABLE analytics_events_rebuild;
+
+DROP TABLE IF EXISTS audit_logs_rebuild;
+
+CREATE TABLE audit_logs_rebuild (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    action String,
+    resource String,
+    resource_id String,
+    details String,
+    ip_address String,
+    user_agent String
+)
+ENGINE = MergeTree()
+ORDER BY (timestamp, user_id);
+
+INSERT INTO audit_logs_rebuild (id, timestamp, org_id, user_id, action, resource, resource_id, details, ip_address, user_agent)
+SELECT id, timestamp, org_id, user_id, action, resource, resource_id, details, ip_address, user_agent FROM audit_logs;
+
+EXCHANGE TABLES audit_logs AND audit_logs_rebuild;
+
+DROP TABLE audit_logs_rebuild;
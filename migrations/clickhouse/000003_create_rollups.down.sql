@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS api_latency_hourly_mv;
+DROP TABLE IF EXISTS api_latency_hourly;
+
+DROP VIEW IF EXISTS daily_active_users_mv;
+DROP TABLE IF EXISTS daily_active_users;
+
+DROP VIEW IF EXISTS analytics_events_hourly_mv;
+DROP TABLE IF EXISTS analytics_events_hourly;
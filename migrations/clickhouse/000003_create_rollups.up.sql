@@ -0,0 +1,81 @@
+-- Dashboard rollups. Each materialized view aggregates new analytics_events
+-- inserts into an AggregatingMergeTree table; existing rows are backfilled
+-- once below. Rows copied by pseudonymization are marked in metadata and
+-- skipped so erased users are not counted twice.
+CREATE TABLE IF NOT EXISTS analytics_events_hourly (
+    org_id UInt64,
+    event LowCardinality(String),
+    hour DateTime('UTC'),
+    events AggregateFunction(count),
+    users AggregateFunction(uniq, UInt64)
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(hour)
+ORDER BY (org_id, event, hour);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_events_hourly_mv TO analytics_events_hourly AS
+SELECT
+    org_id,
+    event,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS events,
+    uniqState(user_id) AS users
+FROM analytics_events
+WHERE metadata != '{"pseudonymized":true}'
+GROUP BY org_id, event, hour;
+
+CREATE TABLE IF NOT EXISTS daily_active_users (
+    org_id UInt64,
+    day Date,
+    users AggregateFunction(uniq, UInt64)
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(day)
+ORDER BY (org_id, day);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_active_users_mv TO daily_active_users AS
+SELECT
+    org_id,
+    toDate(timestamp, 'UTC') AS day,
+    uniqState(user_id) AS users
+FROM analytics_events
+WHERE user_id != 0 AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, day;
+
+CREATE TABLE IF NOT EXISTS api_latency_hourly (
+    org_id UInt64,
+    method LowCardinality(String),
+    endpoint String,
+    hour DateTime('UTC'),
+    requests AggregateFunction(count),
+    errors AggregateFunction(countIf, UInt8),
+    duration_ms AggregateFunction(quantilesTDigest(0.5, 0.9, 0.99), Float64)
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(hour)
+ORDER BY (org_id, endpoint, method, hour);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_latency_hourly_mv TO api_latency_hourly AS
+SELECT
+    org_id,
+    properties['method'] AS method,
+    properties['endpoint'] AS endpoint,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS requests,
+    countIfState(toUInt16OrZero(properties['status_code']) >= 500) AS errors,
+    quantilesTDigestState(0.5, 0.9, 0.99)(toFloat64OrZero(properties['duration_ms'])) AS duration_ms
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, endpoint, hour;
+
+INSERT INTO analytics_events_hourly
+SELECT org_id, event, toStartOfHour(timestamp, 'UTC') AS hour, countState(), uniqState(user_id)
+FROM analytics_events
+WHERE metadata != '{"pseudonymized":true}'
+GROUP BY org_id, event, hour;
+
+INSERT INTO daily_active_users
+SELECT org_id, toDate(timestamp, 'UTC') AS day, uniqState(user_id)
+FROM analytics_events
+WHERE user_id != 0 AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, day;
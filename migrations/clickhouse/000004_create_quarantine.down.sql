@@ -0,0 +1 @@
+DROP TABLE IF EXISTS analytics_events_quarantine;
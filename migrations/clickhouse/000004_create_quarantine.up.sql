@@ -0,0 +1,16 @@
+-- Events that failed schema validation in quarantine mode. They are kept out
+-- of analytics_events, and so out of every report, until fixed and resent.
+CREATE TABLE IF NOT EXISTS analytics_events_quarantine (
+    received_at DateTime64(3),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    event String,
+    metadata String,
+    properties Map(String, String),
+    errors Array(String)
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(received_at)
+ORDER BY (org_id, received_at)
+TTL toDateTime(received_at) + INTERVAL 30 DAY;
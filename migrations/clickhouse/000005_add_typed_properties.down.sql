@@ -0,0 +1,9 @@
+ALTER TABLE analytics_events_quarantine
+    DROP COLUMN IF EXISTS properties_array,
+    DROP COLUMN IF EXISTS properties_bool,
+    DROP COLUMN IF EXISTS properties_number;
+
+ALTER TABLE analytics_events
+    DROP COLUMN IF EXISTS properties_array,
+    DROP COLUMN IF EXISTS properties_bool,
+    DROP COLUMN IF EXISTS properties_number;
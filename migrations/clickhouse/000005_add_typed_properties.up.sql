@@ -0,0 +1,21 @@
+-- properties keeps the string form of every property, so existing queries and
+-- the rollup views are unaffected. Numbers, bools and arrays also get a typed
+-- copy that queries can use without casting.
+ALTER TABLE analytics_events
+    ADD COLUMN IF NOT EXISTS properties_number Map(String, Float64) AFTER properties,
+    ADD COLUMN IF NOT EXISTS properties_bool Map(String, Bool) AFTER properties_number,
+    ADD COLUMN IF NOT EXISTS properties_array Map(String, Array(String)) AFTER properties_bool;
+
+ALTER TABLE analytics_events_quarantine
+    ADD COLUMN IF NOT EXISTS properties_number Map(String, Float64) AFTER properties,
+    ADD COLUMN IF NOT EXISTS properties_bool Map(String, Bool) AFTER properties_number,
+    ADD COLUMN IF NOT EXISTS properties_array Map(String, Array(String)) AFTER properties_bool;
+
+-- Existing rows only have strings: values that parse as numbers or are true or
+-- false get a typed copy. Arrays cannot be told apart from strings and stay
+-- strings.
+ALTER TABLE analytics_events UPDATE
+    properties_number = CAST(mapApply((k, v) -> (k, toFloat64(v)), mapFilter((k, v) -> isNotNull(toFloat64OrNull(v)), properties)), 'Map(String, Float64)'),
+    properties_bool = CAST(mapApply((k, v) -> (k, v = 'true'), mapFilter((k, v) -> v IN ('true', 'false'), properties)), 'Map(String, Bool)')
+WHERE notEmpty(properties)
+SETTINGS mutations_sync = 1;
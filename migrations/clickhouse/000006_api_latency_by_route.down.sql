@@ -0,0 +1,41 @@
+DROP VIEW IF EXISTS api_latency_hourly_mv;
+DROP TABLE IF EXISTS api_latency_hourly;
+
+CREATE TABLE IF NOT EXISTS api_latency_hourly (
+    org_id UInt64,
+    method LowCardinality(String),
+    endpoint String,
+    hour DateTime('UTC'),
+    requests AggregateFunction(count),
+    errors AggregateFunction(countIf, UInt8),
+    duration_ms AggregateFunction(quantilesTDigest(0.5, 0.9, 0.99), Float64)
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(hour)
+ORDER BY (org_id, endpoint, method, hour);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_latency_hourly_mv TO api_latency_hourly AS
+SELECT
+    org_id,
+    properties['method'] AS method,
+    properties['endpoint'] AS endpoint,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS requests,
+    countIfState(toUInt16OrZero(properties['status_code']) >= 500) AS errors,
+    quantilesTDigestState(0.5, 0.9, 0.99)(toFloat64OrZero(properties['duration_ms'])) AS duration_ms
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, endpoint, hour;
+
+INSERT INTO api_latency_hourly
+SELECT
+    org_id,
+    properties['method'] AS method,
+    properties['endpoint'] AS endpoint,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState(),
+    countIfState(toUInt16OrZero(properties['status_code']) >= 500),
+    quantilesTDigestState(0.5, 0.9, 0.99)(toFloat64OrZero(properties['duration_ms']))
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, endpoint, hour;
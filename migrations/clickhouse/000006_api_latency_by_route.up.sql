@@ -0,0 +1,50 @@
+-- Group API latency by route template instead of the raw path, so /users/1
+-- and /users/2 share a row, and add request and response size percentiles.
+-- Requests recorded before routes were captured fall back to their path.
+DROP VIEW IF EXISTS api_latency_hourly_mv;
+DROP TABLE IF EXISTS api_latency_hourly;
+
+CREATE TABLE IF NOT EXISTS api_latency_hourly (
+    org_id UInt64,
+    method LowCardinality(String),
+    route String,
+    hour DateTime('UTC'),
+    requests AggregateFunction(count),
+    errors AggregateFunction(countIf, UInt8),
+    duration_ms AggregateFunction(quantilesTDigest(0.5, 0.9, 0.99), Float64),
+    request_bytes AggregateFunction(quantilesTDigestIf(0.5, 0.9, 0.99), Float64, UInt8),
+    response_bytes AggregateFunction(quantilesTDigestIf(0.5, 0.9, 0.99), Float64, UInt8)
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(hour)
+ORDER BY (org_id, route, method, hour);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_latency_hourly_mv TO api_latency_hourly AS
+SELECT
+    org_id,
+    properties['method'] AS method,
+    if(properties['route'] != '', properties['route'], properties['endpoint']) AS route,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS requests,
+    countIfState(properties_number['status_code'] >= 500) AS errors,
+    quantilesTDigestState(0.5, 0.9, 0.99)(properties_number['duration_ms']) AS duration_ms,
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['request_bytes'], mapContains(properties_number, 'request_bytes')) AS request_bytes,
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['response_bytes'], mapContains(properties_number, 'response_bytes')) AS response_bytes
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties_number, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, route, hour;
+
+INSERT INTO api_latency_hourly
+SELECT
+    org_id,
+    properties['method'] AS method,
+    if(properties['route'] != '', properties['route'], properties['endpoint']) AS route,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState(),
+    countIfState(properties_number['status_code'] >= 500),
+    quantilesTDigestState(0.5, 0.9, 0.99)(properties_number['duration_ms']),
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['request_bytes'], mapContains(properties_number, 'request_bytes')),
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['response_bytes'], mapContains(properties_number, 'response_bytes'))
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties_number, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, route, hour;
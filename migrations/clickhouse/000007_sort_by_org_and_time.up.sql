@@ -0,0 +1,99 @@
+-- Every report filters on an organization and a time range, so sort by
+-- those first. A bloom filter index on user_id keeps per-user export and
+-- erasure from reading every granule. The sorting key cannot be changed in
+-- place: the rollup views are detached, both tables are copied into the new
+-- layout and swapped, and the views are attached again. Run before services
+-- start so no rows are written during the copy. The new tables have no TTL
+-- or storage policy; make migrate-up applies retention again afterwards.
+DROP VIEW IF EXISTS api_latency_hourly_mv;
+DROP VIEW IF EXISTS daily_active_users_mv;
+DROP VIEW IF EXISTS analytics_events_hourly_mv;
+
+DROP TABLE IF EXISTS analytics_events_rebuild;
+
+CREATE TABLE analytics_events_rebuild (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    event LowCardinality(String),
+    metadata String,
+    properties Map(String, String),
+    properties_number Map(String, Float64),
+    properties_bool Map(String, Bool),
+    properties_array Map(String, Array(String)),
+    INDEX user_id_idx user_id TYPE bloom_filter GRANULARITY 4
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (org_id, toStartOfHour(timestamp), user_id, event, timestamp);
+
+INSERT INTO analytics_events_rebuild (id, timestamp, org_id, user_id, event, metadata, properties, properties_number, properties_bool, properties_array)
+SELECT id, timestamp, org_id, user_id, event, metadata, properties, properties_number, properties_bool, properties_array FROM analytics_events;
+
+EXCHANGE TABLES analytics_events AND analytics_events_rebuild;
+
+DROP TABLE analytics_events_rebuild;
+
+DROP TABLE IF EXISTS audit_logs_rebuild;
+
+CREATE TABLE audit_logs_rebuild (
+    id UUID DEFAULT generateUUIDv4(),
+    timestamp DateTime64(3),
+    org_id UInt64,
+    user_id UInt64,
+    action LowCardinality(String),
+    resource LowCardinality(String),
+    resource_id String,
+    details String,
+    ip_address String,
+    user_agent String,
+    INDEX user_id_idx user_id TYPE bloom_filter GRANULARITY 4
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (org_id, toStartOfHour(timestamp), user_id, timestamp);
+
+INSERT INTO audit_logs_rebuild (id, timestamp, org_id, user_id, action, resource, resource_id, details, ip_address, user_agent)
+SELECT id, timestamp, org_id, user_id, action, resource, resource_id, details, ip_address, user_agent FROM audit_logs;
+
+EXCHANGE TABLES audit_logs AND audit_logs_rebuild;
+
+DROP TABLE audit_logs_rebuild;
+
+-- Attach the rollup views to the swapped table. The rollups themselves are
+-- untouched and the copy above did not pass through the views.
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_events_hourly_mv TO analytics_events_hourly AS
+SELECT
+    org_id,
+    event,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS events,
+    uniqState(user_id) AS users
+FROM analytics_events
+WHERE metadata != '{"pseudonymized":true}'
+GROUP BY org_id, event, hour;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_active_users_mv TO daily_active_users AS
+SELECT
+    org_id,
+    toDate(timestamp, 'UTC') AS day,
+    uniqState(user_id) AS users
+FROM analytics_events
+WHERE user_id != 0 AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, day;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_latency_hourly_mv TO api_latency_hourly AS
+SELECT
+    org_id,
+    properties['method'] AS method,
+    if(properties['route'] != '', properties['route'], properties['endpoint']) AS route,
+    toStartOfHour(timestamp, 'UTC') AS hour,
+    countState() AS requests,
+    countIfState(properties_number['status_code'] >= 500) AS errors,
+    quantilesTDigestState(0.5, 0.9, 0.99)(properties_number['duration_ms']) AS duration_ms,
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['request_bytes'], mapContains(properties_number, 'request_bytes')) AS request_bytes,
+    quantilesTDigestIfState(0.5, 0.9, 0.99)(properties_number['response_bytes'], mapContains(properties_number, 'response_bytes')) AS response_bytes
+FROM analytics_events
+WHERE event = 'api_request' AND mapContains(properties_number, 'duration_ms') AND metadata != '{"pseudonymized":true}'
+GROUP BY org_id, method, route, hour;
@@ -0,0 +1,142 @@
+package alerting
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule sources.
+const (
+	SourceAnalytics = "analytics"
+	SourceAudit     = "audit"
+)
+
+// Sink types.
+const (
+	SinkLog     = "log"
+	SinkEmail   = "email"
+	SinkWebhook = "webhook"
+)
+
+// Config is the alert rules file.
+type Config struct {
+	Sinks map[string]SinkConfig `yaml:"sinks"`
+	Rules []Rule                `yaml:"rules"`
+}
+
+// SinkConfig describes where alerts are sent. To is used by email sinks and
+// URL and Headers by webhook sinks.
+type SinkConfig struct {
+	Type    string            `yaml:"type"`
+	To      []string          `yaml:"to"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Match selects events. Event is the analytics event name or audit action,
+// Resource applies to audit logs only, and every entry of Properties must be
+// equal to the string form of the event's property (numbers in shortest
+// decimal form, bools as true or false). Empty fields match anything.
+type Match struct {
+	Event      string            `yaml:"event"`
+	Resource   string            `yaml:"resource"`
+	Properties map[string]string `yaml:"properties"`
+}
+
+// Rule fires when Threshold matching events with the same group happen within
+// Window. Events are always grouped by organization; GroupBy adds user_id,
+// resource_id or property names. A group that fired is not notified again
+// until Cooldown has passed.
+type Rule struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Severity    string        `yaml:"severity"`
+	Source      string        `yaml:"source"`
+	Match       Match         `yaml:"match"`
+	GroupBy     []string      `yaml:"group_by"`
+	Threshold   int           `yaml:"threshold"`
+	Window      time.Duration `yaml:"window"`
+	Cooldown    time.Duration `yaml:"cooldown"`
+	Sinks       []string      `yaml:"sinks"`
+}
+
+// defaultCooldown applies to rules without a cooldown or window.
+const defaultCooldown = time.Hour
+
+// LoadConfig reads and validates a rules file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid alert rules in %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	for name, sink := range cfg.Sinks {
+		switch sink.Type {
+		case SinkLog:
+		case SinkEmail:
+			if len(sink.To) == 0 {
+				return fmt.Errorf("sink %q: email sinks need at least one recipient", name)
+			}
+		case SinkWebhook:
+			if sink.URL == "" {
+				return fmt.Errorf("sink %q: webhook sinks need a url", name)
+			}
+		default:
+			return fmt.Errorf("sink %q: unknown type %q", name, sink.Type)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("rule %q is defined twice", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		if rule.Source != SourceAnalytics && rule.Source != SourceAudit {
+			return fmt.Errorf("rule %q: source must be %s or %s", rule.Name, SourceAnalytics, SourceAudit)
+		}
+		if rule.Threshold < 1 {
+			rule.Threshold = 1
+		}
+		if rule.Threshold > 1 && rule.Window <= 0 {
+			return fmt.Errorf("rule %q: a threshold above 1 needs a window", rule.Name)
+		}
+		if rule.Cooldown <= 0 {
+			rule.Cooldown = rule.Window
+			if rule.Cooldown <= 0 {
+				rule.Cooldown = defaultCooldown
+			}
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		if len(rule.Sinks) == 0 {
+			return fmt.Errorf("rule %q has no sinks", rule.Name)
+		}
+		for _, sink := range rule.Sinks {
+			if _, ok := cfg.Sinks[sink]; !ok {
+				return fmt.Errorf("rule %q: unknown sink %q", rule.Name, sink)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/queue"
+)
+
+// Queue receives a copy of every published event for the engine.
+const Queue = "alerts_queue"
+
+// sweepInterval is how often idle windows are dropped.
+const sweepInterval = time.Minute
+
+// notifyTimeout bounds delivery of one alert to all of its sinks.
+const notifyTimeout = 30 * time.Second
+
+// event is an analytics event or audit log reduced to the fields rules match
+// and group on. Audit logs expose resource_id, ip_address and user_agent as
+// properties.
+type event struct {
+	source     string
+	timestamp  time.Time
+	orgID      uint64
+	userID     uint64
+	name       string
+	resource   string
+	properties map[string]string
+	raw        json.RawMessage
+}
+
+func (e event) field(name string) string {
+	switch name {
+	case "user_id":
+		return strconv.FormatUint(e.userID, 10)
+	case "event", "action":
+		return e.name
+	case "resource":
+		return e.resource
+	}
+	return e.properties[name]
+}
+
+func (m Match) matches(e event) bool {
+	if m.Event != "" && m.Event != e.name {
+		return false
+	}
+	if m.Resource != "" && m.Resource != e.resource {
+		return false
+	}
+	for k, v := range m.Properties {
+		if e.properties[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// window holds the timestamps of the most recent matching events of one rule
+// and group. At most Threshold are kept, which is all a rule needs to decide.
+type window struct {
+	times []time.Time
+}
+
+// Engine evaluates rules against the event stream. It keeps windows in
+// memory, so a deployment should run a single engine.
+type Engine struct {
+	db      *database.Database
+	rules   []Rule
+	sinks   map[string]Sink
+	windows map[string]*window
+	wg      sync.WaitGroup
+}
+
+func NewEngine(cfg *Config, db *database.Database, m mailer.Mailer) *Engine {
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+	for name, sinkCfg := range cfg.Sinks {
+		sinks[name] = newSink(sinkCfg, m)
+	}
+	return &Engine{
+		db:      db,
+		rules:   cfg.Rules,
+		sinks:   sinks,
+		windows: make(map[string]*window),
+	}
+}
+
+// DeclareQueue creates the engine's durable queue and binds it to every event.
+func DeclareQueue(rabbitmq *queue.RabbitMQ) error {
+	if err := rabbitmq.DeclareQueue(Queue); err != nil {
+		return err
+	}
+	return rabbitmq.BindQueue(Queue, "#", events.Exchange)
+}
+
+// Run evaluates msgs until the channel closes or ctx is cancelled, then waits
+// for notifications in flight.
+func (e *Engine) Run(ctx context.Context, msgs <-chan queue.Message) {
+	defer e.wg.Wait()
+
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				log.Printf("Alerting queue closed")
+				return
+			}
+			ev, err := decodeEvent(msg)
+			if err != nil {
+				log.Printf("Error decoding event for alerting: %v", err)
+				msg.Nack(false)
+				continue
+			}
+			e.evaluate(ctx, ev)
+			msg.Ack()
+		case now := <-sweep.C:
+			e.sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Engine) evaluate(ctx context.Context, ev event) {
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Source != ev.source || !rule.Match.matches(ev) {
+			continue
+		}
+
+		group := map[string]string{"org_id": strconv.FormatUint(ev.orgID, 10)}
+		for _, name := range rule.GroupBy {
+			group[name] = ev.field(name)
+		}
+		groupKey := encodeGroup(group)
+
+		key := rule.Name + "\x00" + groupKey
+		w := e.windows[key]
+		if w == nil {
+			w = &window{}
+			e.windows[key] = w
+		}
+		w.times = append(w.times, ev.timestamp)
+		cutoff := ev.timestamp.Add(-rule.Window)
+		for len(w.times) > 0 && (w.times[0].Before(cutoff) || len(w.times) > rule.Threshold) {
+			w.times = w.times[1:]
+		}
+		if len(w.times) < rule.Threshold {
+			continue
+		}
+
+		alert := Alert{
+			Rule:        rule.Name,
+			Description: rule.Description,
+			Severity:    rule.Severity,
+			OrgID:       ev.orgID,
+			Group:       group,
+			Count:       len(w.times),
+			FirstSeen:   w.times[0],
+			LastSeen:    w.times[len(w.times)-1],
+			Event:       ev.raw,
+		}
+		// Start counting afresh so the rule needs a full threshold again
+		delete(e.windows, key)
+
+		notify, err := models.RecordAlert(ctx, e.db.Pool, rule.Name, groupKey, ev.orgID, rule.Severity, alert.Count, rule.Cooldown)
+		if err != nil {
+			log.Printf("Error recording alert %s: %v", rule.Name, err)
+			continue
+		}
+		if notify {
+			e.notify(*rule, alert)
+		}
+	}
+}
+
+// notify delivers the alert to the rule's sinks in the background so slow
+// sinks do not hold up evaluation.
+func (e *Engine) notify(rule Rule, alert Alert) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		for _, name := range rule.Sinks {
+			if err := e.sinks[name].Notify(ctx, alert); err != nil {
+				log.Printf("Error sending alert %s to %s: %v", rule.Name, name, err)
+			}
+		}
+	}()
+}
+
+// sweep drops windows whose newest event is older than the longest window,
+// so groups that stopped producing events do not accumulate.
+func (e *Engine) sweep(now time.Time) {
+	var longest time.Duration
+	for _, rule := range e.rules {
+		if rule.Window > longest {
+			longest = rule.Window
+		}
+	}
+	for key, w := range e.windows {
+		if len(w.times) == 0 || now.Sub(w.times[len(w.times)-1]) > longest {
+			delete(e.windows, key)
+		}
+	}
+}
+
+// encodeGroup renders group as sorted key=value pairs for storage.
+func encodeGroup(group map[string]string) string {
+	keys := make([]string, 0, len(group))
+	for k := range group {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + group[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeEvent(msg queue.Message) (event, error) {
+	ev := event{source: msg.RoutingKey, raw: msg.Body}
+	switch msg.RoutingKey {
+	case events.RoutingKeyAnalytics:
+		var a models.AnalyticsEvent
+		if err := json.Unmarshal(msg.Body, &a); err != nil {
+			return event{}, err
+		}
+		ev.timestamp, ev.orgID, ev.userID, ev.name, ev.properties = a.Timestamp, a.OrgID, a.UserID, a.Event, a.Properties.Strings()
+	case events.RoutingKeyAudit:
+		var l models.AuditLog
+		if err := json.Unmarshal(msg.Body, &l); err != nil {
+			return event{}, err
+		}
+		ev.timestamp, ev.orgID, ev.userID, ev.name, ev.resource = l.Timestamp, l.OrgID, l.UserID, l.Action, l.Resource
+		ev.properties = map[string]string{
+			"resource_id": l.ResourceID,
+			"ip_address":  l.IPAddress,
+			"user_agent":  l.UserAgent,
+		}
+	}
+	if ev.timestamp.IsZero() {
+		ev.timestamp = time.Now()
+	}
+	return ev, nil
+}
@@ -0,0 +1,65 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-turbo/pkg/database"
+)
+
+// leaderLockKey is the Postgres advisory lock held by the running engine.
+const leaderLockKey = 0x616c65727473 // "alerts"
+
+// leaderCheckInterval is how often the leader checks it still holds the lock,
+// and so how long a standby and a leader that lost its connection may overlap.
+const leaderCheckInterval = 5 * time.Second
+
+// AcquireLeadership blocks until this process holds the engine's advisory
+// lock, so that only one engine consumes Queue and every event of a window
+// reaches the same process. Standby instances wait here and take over when
+// the holder's connection closes.
+//
+// The returned context is cancelled when the lock's connection fails, since
+// Postgres has then released the lock to a standby; pass it to Run. The
+// returned function releases the lock.
+func AcquireLeadership(ctx context.Context, db *database.Database) (context.Context, func(), error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error acquiring connection: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", leaderLockKey); err != nil {
+		conn.Release()
+		return nil, nil, fmt.Errorf("error acquiring alerting lock: %w", err)
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(leaderCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.Ping(leaderCtx); err != nil {
+					if leaderCtx.Err() == nil {
+						log.Printf("Lost alerting lock: %v", err)
+					}
+					cancel()
+					return
+				}
+			case <-leaderCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return leaderCtx, func() {
+		cancel()
+		<-done
+		conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", leaderLockKey)
+		conn.Release()
+	}, nil
+}
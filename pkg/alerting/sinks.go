@@ -0,0 +1,125 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/mailer"
+)
+
+// Alert is a rule firing for one group of events.
+type Alert struct {
+	Rule        string            `json:"rule"`
+	Description string            `json:"description,omitempty"`
+	Severity    string            `json:"severity"`
+	OrgID       uint64            `json:"org_id"`
+	Group       map[string]string `json:"group"`
+	Count       int               `json:"count"`
+	FirstSeen   time.Time         `json:"first_seen"`
+	LastSeen    time.Time         `json:"last_seen"`
+	Event       json.RawMessage   `json:"event"`
+}
+
+// Sink delivers alerts.
+type Sink interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+func newSink(cfg SinkConfig, m mailer.Mailer) Sink {
+	switch cfg.Type {
+	case SinkEmail:
+		return &emailSink{mailer: m, to: cfg.To}
+	case SinkWebhook:
+		return &webhookSink{url: cfg.URL, headers: cfg.Headers, client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		return logSink{}
+	}
+}
+
+// summary is a one-line description of the alert.
+func (a Alert) summary() string {
+	keys := make([]string, 0, len(a.Group))
+	for k := range a.Group {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	group := make([]string, len(keys))
+	for i, k := range keys {
+		group[i] = k + "=" + a.Group[k]
+	}
+	return fmt.Sprintf("[%s] %s: %d events between %s and %s (%s)",
+		a.Severity, a.Rule, a.Count, a.FirstSeen.Format(time.RFC3339), a.LastSeen.Format(time.RFC3339), strings.Join(group, " "))
+}
+
+type logSink struct{}
+
+func (logSink) Notify(ctx context.Context, alert Alert) error {
+	log.Printf("ALERT %s", alert.summary())
+	return nil
+}
+
+type emailSink struct {
+	mailer mailer.Mailer
+	to     []string
+}
+
+func (s *emailSink) Notify(ctx context.Context, alert Alert) error {
+	body := alert.summary() + "\n"
+	if alert.Description != "" {
+		body += "\n" + alert.Description + "\n"
+	}
+	if len(alert.Event) > 0 {
+		body += "\nLatest event:\n" + string(alert.Event) + "\n"
+	}
+
+	for _, to := range s.to {
+		err := s.mailer.Send(ctx, mailer.Message{
+			To:      to,
+			Subject: fmt.Sprintf("[%s] Alert: %s", alert.Severity, alert.Rule),
+			Body:    body,
+		})
+		if err != nil {
+			return fmt.Errorf("error emailing %s: %w", to, err)
+		}
+	}
+	return nil
+}
+
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *webhookSink) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting alert: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error posting alert: webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package auth
+
+import "strings"
+
+// APIKeyPrefix marks bearer credentials that are API keys rather than JWTs
+const APIKeyPrefix = "ghk_"
+
+// GenerateAPIKey returns a new key, the short prefix shown in listings and the
+// hash to store. The full key is only ever returned once, at creation.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	secret, err := randomURLString(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + secret
+	return key, key[:len(APIKeyPrefix)+8], HashToken(key), nil
+}
+
+// IsAPIKey reports whether a bearer credential looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key exponent: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// signingKey returns the provider's RSA key with the given kid, refetching
+// the key set once when the kid is unknown so key rotation is picked up.
+func (p *OIDCProvider) signingKey(ctx context.Context, discovery *oidcDiscovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.keys == nil || attempt > 0 {
+			var keys jwks
+			if err := p.getJSON(ctx, discovery.JWKSURI, &keys); err != nil {
+				return nil, fmt.Errorf("error fetching JWKS: %w", err)
+			}
+			p.keys = &keys
+		}
+
+		for _, key := range p.keys.Keys {
+			if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+				continue
+			}
+			if kid == "" || key.Kid == kid {
+				return key.rsaPublicKey()
+			}
+		}
+	}
+	return nil, errors.New("no matching signing key")
+}
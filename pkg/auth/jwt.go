@@ -11,18 +11,90 @@ import (
 
 var jwtSecret = []byte("your-secret-key") // In production, use environment variable
 
+// challengeAudience marks tokens that only prove the first login factor
+const challengeAudience = "2fa_challenge"
+
+const challengeTTL = 5 * time.Minute
+
+// TokenTTL is how long a session token is valid
+const TokenTTL = 24 * time.Hour
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID      uint     `json:"user_id"`
+	OrgID       uint     `json:"org_id"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"`
+	// MFA is set when the token was issued after a second factor was verified
+	MFA bool `json:"mfa,omitempty"`
+	// MFARequired is set when the user's role enforces two-factor authentication
+	MFARequired bool `json:"mfa_required,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(user models.User) (string, error) {
+// TokenOptions carries everything besides the user that goes into a token.
+type TokenOptions struct {
+	SessionID   string
+	OrgID       uint
+	Permissions []string
+	MFA         bool
+	MFARequired bool
+}
+
+// HasPermission reports whether the token was issued with the given permission.
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateJWT issues a token for the user scoped to the given organization. The
+// role's permissions are embedded so authorization checks do not need to hit the
+// database for the token's lifetime.
+func GenerateJWT(user models.User, opts TokenOptions) (string, error) {
+	claims := Claims{
+		UserID:      user.ID,
+		OrgID:       opts.OrgID,
+		Role:        user.Role,
+		Permissions: opts.Permissions,
+		MFA:         opts.MFA,
+		MFARequired: opts.MFARequired,
+		StandardClaims: jwt.StandardClaims{
+			Id:        opts.SessionID,
+			ExpiresAt: time.Now().Add(TokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+func ValidateJWT(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// A challenge token must never be usable as a full session token
+	if claims.Audience != "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// GenerateChallengeToken issues a short-lived token proving the user passed
+// the password step of a two-step login.
+func GenerateChallengeToken(user models.User, orgID uint) (string, error) {
 	claims := Claims{
 		UserID: user.ID,
+		OrgID:  orgID,
 		Role:   user.Role,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			Audience:  challengeAudience,
+			ExpiresAt: time.Now().Add(challengeTTL).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
@@ -31,7 +103,19 @@ func GenerateJWT(user models.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-func ValidateJWT(tokenString string) (*Claims, error) {
+func ValidateChallengeToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Audience != challengeAudience {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -0,0 +1,69 @@
+package auth
+
+import "time"
+
+// LockoutPolicy controls how failed logins are throttled for one scope
+// (an account or a client IP).
+type LockoutPolicy struct {
+	// FreeAttempts is the number of failures allowed before delays kick in
+	FreeAttempts int
+	// BaseDelay doubles with every failure past FreeAttempts, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures within Window trigger a lockout of LockDuration
+	LockAfter    int
+	LockDuration time.Duration
+	// Window after the last failure at which the counter resets
+	Window time.Duration
+}
+
+var (
+	AccountLockoutPolicy = LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    10,
+		LockDuration: 15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+	IPLockoutPolicy = LockoutPolicy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    50,
+		LockDuration: 15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+)
+
+// Delay returns how long the caller must wait after the last failure before
+// another attempt is accepted.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// RetryAfter reports how long an attempt must wait given the current counter,
+// or zero if it may proceed.
+func (p LockoutPolicy) RetryAfter(failures int, lastFailedAt time.Time, lockedUntil *time.Time, now time.Time) time.Duration {
+	if lockedUntil != nil && now.Before(*lockedUntil) {
+		return lockedUntil.Sub(now)
+	}
+	if now.Sub(lastFailedAt) > p.Window {
+		return 0
+	}
+	if wait := lastFailedAt.Add(p.Delay(failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Purposes for single-use action tokens
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailChange       = "email_change"
+)
+
+var ErrInvalidActionToken = errors.New("invalid token")
+
+// GenerateActionToken creates a signed single-use token for the given purpose.
+// The returned hash is what gets stored; the token itself is only sent to the user.
+func GenerateActionToken(purpose string) (token, hash string, err error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(nonce)
+	token = payload + "." + signActionToken(purpose, payload)
+	return token, HashToken(token), nil
+}
+
+// VerifyActionToken checks the token signature for the given purpose and
+// returns the hash to look up in storage.
+func VerifyActionToken(purpose, token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidActionToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(signActionToken(purpose, payload))) {
+		return "", ErrInvalidActionToken
+	}
+	return HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of a token for storage.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func signActionToken(purpose, payload string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(purpose + ":" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,96 @@
+// Command clickhouse-migrate applies the numbered migrations in
+// migrations/clickhouse and then the retention policies from the environment.
+//
+//	clickhouse-migrate [-path dir] up
+//	clickhouse-migrate [-path dir] down [N | all]
+//	clickhouse-migrate force VERSION
+//	clickhouse-migrate version
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"go-turbo/pkg/database/clickhouse"
+)
+
+func main() {
+	path := flag.String("path", "migrations/clickhouse", "directory containing ClickHouse migrations")
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+
+	client, err := clickhouse.NewClient(
+		os.Getenv("CLICKHOUSE_HOST"),
+		os.Getenv("CLICKHOUSE_DATABASE"),
+		os.Getenv("CLICKHOUSE_USER"),
+		os.Getenv("CLICKHOUSE_PASSWORD"),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer client.Close()
+
+	// Rebuilding large tables can take a while, so there is no overall timeout
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		if err := client.MigrateUp(ctx, *path); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if err := client.ApplyRetention(ctx, "analytics_events", clickhouse.AnalyticsRetentionFromEnv()); err != nil {
+			log.Fatalf("Failed to apply analytics retention: %v", err)
+		}
+		if err := client.ApplyRetention(ctx, "audit_logs", clickhouse.AuditRetentionFromEnv()); err != nil {
+			log.Fatalf("Failed to apply audit retention: %v", err)
+		}
+
+	case "down":
+		// Reverting everything drops the event tables, so it must be asked for
+		steps := 1
+		switch arg := flag.Arg(1); arg {
+		case "":
+		case "all":
+			steps = math.MaxInt
+		default:
+			if steps, err = strconv.Atoi(arg); err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps %q", arg)
+			}
+		}
+		if err := client.MigrateDown(ctx, *path, steps); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+
+	case "force":
+		version, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid version %q", flag.Arg(1))
+		}
+		if err := client.ForceMigrationVersion(ctx, version); err != nil {
+			log.Fatalf("Failed to force version: %v", err)
+		}
+
+	case "version":
+		status, err := client.MigrationVersion(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read version: %v", err)
+		}
+		if status.Dirty {
+			fmt.Printf("%d (dirty)\n", status.Version)
+		} else {
+			fmt.Println(status.Version)
+		}
+
+	default:
+		log.Fatalf("Unknown command %q; use up, down, force or version", command)
+	}
+}
@@ -3,7 +3,6 @@ package clickhouse
 import (
 	"context"
 	"fmt"
-	"log"
 	"time"
 
 	"go-turbo/pkg/models"
@@ -51,61 +50,19 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
-func (c *Client) CreateAnalyticsTable(ctx context.Context) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS analytics_events (
-			id UUID DEFAULT generateUUIDv4(),
-			timestamp DateTime64(3),
-			user_id UInt64,
-			event String,
-			metadata String,
-			properties Map(String, String)
-		)
-		ENGINE = MergeTree()
-		ORDER BY (timestamp, user_id)
-	`
-	if err := c.conn.Exec(ctx, query); err != nil {
-		return fmt.Errorf("error creating analytics table: %w", err)
-	}
-	log.Println("Analytics table created/verified successfully")
-	return nil
-}
-
-func (c *Client) CreateAuditLogsTable(ctx context.Context) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS audit_logs (
-			id UUID DEFAULT generateUUIDv4(),
-			timestamp DateTime64(3),
-			user_id UInt64,
-			action String,
-			resource String,
-			resource_id String,
-			details String,
-			ip_address String,
-			user_agent String
-		)
-		ENGINE = MergeTree()
-		ORDER BY (timestamp, user_id)
-	`
-	if err := c.conn.Exec(ctx, query); err != nil {
-		return fmt.Errorf("error creating audit logs table: %w", err)
-	}
-	log.Println("Audit logs table created/verified successfully")
-	return nil
-}
-
 func (c *Client) InsertAuditLog(ctx context.Context, log models.AuditLog) error {
 	query := `
 		INSERT INTO audit_logs (
-			timestamp, user_id, action, resource, resource_id,
+			timestamp, org_id, user_id, action, resource, resource_id,
 			details, ip_address, user_agent
 		) VALUES (
-			?, ?, ?, ?, ?, ?, ?, ?
+			?, ?, ?, ?, ?, ?, ?, ?, ?
 		)
 	`
 
 	if err := c.conn.Exec(ctx, query,
 		log.Timestamp,
+		log.OrgID,
 		log.UserID,
 		log.Action,
 		log.Resource,
@@ -122,40 +79,43 @@ func (c *Client) InsertAuditLog(ctx context.Context, log models.AuditLog) error
 func (c *Client) InsertAnalyticsEvent(ctx context.Context, event models.AnalyticsEvent) error {
 	query := `
 		INSERT INTO analytics_events (
-			timestamp, user_id, event, metadata, properties
+			timestamp, org_id, user_id, event, metadata, ` + propertyColumns + `
 		) VALUES (
-			?, ?, ?, ?, ?
+			?, ?, ?, ?, ?, ?, ?, ?, ?
 		)
 	`
 
-	if err := c.conn.Exec(ctx, query,
+	args := append([]interface{}{
 		event.Timestamp,
+		event.OrgID,
 		event.UserID,
 		event.Event,
 		event.Metadata,
-		event.Properties,
-	); err != nil {
+	}, propertyValues(event.Properties)...)
+	if err := c.conn.Exec(ctx, query, args...); err != nil {
 		return fmt.Errorf("error inserting analytics event: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) GetAnalyticsEvents(ctx context.Context, userID uint64) ([]models.AnalyticsEvent, error) {
+// GetAnalyticsEvents returns the latest events for a user within an organization.
+func (c *Client) GetAnalyticsEvents(ctx context.Context, orgID, userID uint64) ([]models.AnalyticsEvent, error) {
 	query := `
 		SELECT
 			id,
 			timestamp,
+			org_id,
 			user_id,
 			event,
 			metadata,
-			properties
+			` + propertyColumns + `
 			FROM analytics_events
-			WHERE user_id = ?
+			WHERE org_id = ? AND user_id = ?
 			ORDER BY timestamp DESC
 			LIMIT 1000
 	`
 
-	rows, err := c.conn.Query(ctx, query, userID)
+	rows, err := c.conn.Query(ctx, query, orgID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying analytics events: %w", err)
 	}
@@ -164,16 +124,18 @@ func (c *Client) GetAnalyticsEvents(ctx context.Context, userID uint64) ([]model
 	var events []models.AnalyticsEvent
 	for rows.Next() {
 		var event models.AnalyticsEvent
-		if err := rows.Scan(
+		var props propertyMaps
+		if err := rows.Scan(props.scanArgs(
 			&event.ID,
 			&event.Timestamp,
+			&event.OrgID,
 			&event.UserID,
 			&event.Event,
 			&event.Metadata,
-			&event.Properties,
-		); err != nil {
+		)...); err != nil {
 			return nil, fmt.Errorf("error scanning analytics event: %w", err)
 		}
+		event.Properties = props.properties()
 		events = append(events, event)
 	}
 
@@ -188,11 +150,13 @@ func (c *Client) GetAnalyticsEvents(ctx context.Context, userID uint64) ([]model
 	return events, nil
 }
 
-func (c *Client) GetAuditLogs(ctx context.Context, userID uint64) ([]models.AuditLog, error) {
+// GetAuditLogs returns the latest audit logs for a user within an organization.
+func (c *Client) GetAuditLogs(ctx context.Context, orgID, userID uint64) ([]models.AuditLog, error) {
 	query := `
 		SELECT
 			id,
 			timestamp,
+			org_id,
 			user_id,
 			action,
 			resource,
@@ -201,12 +165,12 @@ func (c *Client) GetAuditLogs(ctx context.Context, userID uint64) ([]models.Audi
 			ip_address,
 			user_agent
 		FROM audit_logs
-		WHERE user_id = ?
+		WHERE org_id = ? AND user_id = ?
 		ORDER BY timestamp DESC
 		LIMIT 1000
 	`
 
-	rows, err := c.conn.Query(ctx, query, userID)
+	rows, err := c.conn.Query(ctx, query, orgID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying audit logs: %w", err)
 	}
@@ -218,6 +182,7 @@ func (c *Client) GetAuditLogs(ctx context.Context, userID uint64) ([]models.Audi
 		if err := rows.Scan(
 			&log.ID,
 			&log.Timestamp,
+			&log.OrgID,
 			&log.UserID,
 			&log.Action,
 			&log.Resource,
@@ -0,0 +1,153 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Cohort granularities accepted by GetRetentionCohorts.
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// cohortBuckets maps a granularity to the expression that truncates a
+// timestamp to its UTC bucket and the expression that counts whole periods
+// between two buckets. Weeks start on Monday.
+var cohortBuckets = map[string]struct{ bucket, periods string }{
+	GranularityDay:   {"toDate(%s, 'UTC')", "dateDiff('day', cohort, bucket)"},
+	GranularityWeek:  {"toMonday(toDate(%s, 'UTC'))", "intDiv(dateDiff('day', cohort, bucket), 7)"},
+	GranularityMonth: {"toStartOfMonth(toDate(%s, 'UTC'))", "dateDiff('month', cohort, bucket)"},
+}
+
+// RetentionQuery selects users whose first CohortEvent (any event when empty)
+// happened in [From, To), groups them by the bucket of that first event, and
+// counts how many did ReturnEvent (any event when empty) in each of the
+// following Periods buckets.
+type RetentionQuery struct {
+	Granularity string
+	CohortEvent string
+	ReturnEvent string
+	From        time.Time
+	To          time.Time
+	Periods     int
+}
+
+// RetentionCohort is one row of a retention table. Retained[i] is the number
+// of cohort users who returned i periods after their cohort bucket; period 0
+// is the cohort bucket itself.
+type RetentionCohort struct {
+	Cohort   time.Time `json:"cohort"`
+	Users    uint64    `json:"users"`
+	Retained []uint64  `json:"retained"`
+}
+
+// IsValidGranularity reports whether g is a supported cohort granularity.
+func IsValidGranularity(g string) bool {
+	_, ok := cohortBuckets[g]
+	return ok
+}
+
+// GetRetentionCohorts computes a retention table for the organization,
+// oldest cohort first.
+func (c *Client) GetRetentionCohorts(ctx context.Context, orgID uint64, q RetentionQuery) ([]RetentionCohort, error) {
+	exprs, ok := cohortBuckets[q.Granularity]
+	if !ok {
+		return nil, fmt.Errorf("error querying retention: unknown granularity %q", q.Granularity)
+	}
+	if q.Periods <= 0 {
+		return nil, fmt.Errorf("error querying retention: periods must be positive")
+	}
+
+	cohortArgs := []interface{}{orgID}
+	cohortFilter := ""
+	if q.CohortEvent != "" {
+		cohortFilter = " AND event = ?"
+		cohortArgs = append(cohortArgs, q.CohortEvent)
+	}
+	cohortArgs = append(cohortArgs, q.From, q.To)
+
+	// First events are taken over the user's whole history, so users active
+	// before From are not counted as new.
+	cohorts := fmt.Sprintf(`
+		SELECT user_id, %s AS cohort
+		FROM analytics_events
+		WHERE org_id = ? AND user_id != 0%s
+		GROUP BY user_id
+		HAVING min(timestamp) >= ? AND min(timestamp) < ?
+	`, fmt.Sprintf(exprs.bucket, "min(timestamp)"), cohortFilter)
+
+	rows, err := c.conn.Query(ctx, fmt.Sprintf(`
+		SELECT cohort, count()
+		FROM (%s)
+		GROUP BY cohort
+		ORDER BY cohort
+	`, cohorts), cohortArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying retention cohorts: %w", err)
+	}
+	defer rows.Close()
+
+	result := []RetentionCohort{}
+	index := map[string]int{}
+	for rows.Next() {
+		cohort := RetentionCohort{Retained: make([]uint64, q.Periods+1)}
+		if err := rows.Scan(&cohort.Cohort, &cohort.Users); err != nil {
+			return nil, fmt.Errorf("error scanning retention cohort: %w", err)
+		}
+		index[cohort.Cohort.Format("2006-01-02")] = len(result)
+		result = append(result, cohort)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retention cohorts: %w", err)
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	returnArgs := append([]interface{}{}, cohortArgs...)
+	returnArgs = append(returnArgs, orgID, q.From)
+	returnFilter := ""
+	if q.ReturnEvent != "" {
+		returnFilter = " AND event = ?"
+		returnArgs = append(returnArgs, q.ReturnEvent)
+	}
+	returnArgs = append(returnArgs, q.Periods)
+
+	rows, err = c.conn.Query(ctx, fmt.Sprintf(`
+		SELECT cohort, toUInt32(%s) AS period, uniqExact(c.user_id)
+		FROM (%s) AS c
+		INNER JOIN (
+			SELECT DISTINCT user_id, %s AS bucket
+			FROM analytics_events
+			WHERE org_id = ? AND user_id != 0 AND timestamp >= ?%s
+		) AS a ON a.user_id = c.user_id
+		WHERE bucket >= cohort
+		GROUP BY cohort, period
+		HAVING period <= ?
+	`, exprs.periods, cohorts, fmt.Sprintf(exprs.bucket, "timestamp"), returnFilter), returnArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying retention returns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cohort time.Time
+			period uint32
+			users  uint64
+		)
+		if err := rows.Scan(&cohort, &period, &users); err != nil {
+			return nil, fmt.Errorf("error scanning retention returns: %w", err)
+		}
+		if i, ok := index[cohort.Format("2006-01-02")]; ok && int(period) <= q.Periods {
+			result[i].Retained[period] = users
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retention returns: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+// MaxFunnelSteps is the number of steps windowFunnel accepts.
+const MaxFunnelSteps = 32
+
+// FunnelStep matches events with the given name whose properties contain every
+// key/value pair in Properties, compared by type: 200 does not match "200".
+type FunnelStep struct {
+	Event      string            `json:"event"`
+	Properties models.Properties `json:"properties,omitempty"`
+}
+
+// condition renders the step as a boolean expression and appends its bound
+// values to args.
+func (s FunnelStep) condition(args []interface{}) (string, []interface{}) {
+	args = append(args, s.Event)
+	parts, args := propertiesCondition(s.Properties, args)
+	return "(" + strings.Join(append([]string{"event = ?"}, parts...), " AND ") + ")", args
+}
+
+// GetFunnel counts the users in the organization who completed each step in
+// order, with every step after the first happening within window of the first.
+// The funnel must start in [from, to). The result has one entry per step; entry
+// i is the number of users who reached at least step i+1.
+func (c *Client) GetFunnel(ctx context.Context, orgID uint64, steps []FunnelStep, window time.Duration, from, to time.Time) ([]uint64, error) {
+	if len(steps) == 0 || len(steps) > MaxFunnelSteps {
+		return nil, fmt.Errorf("error querying funnel: need 1 to %d steps, got %d", MaxFunnelSteps, len(steps))
+	}
+
+	args := []interface{}{uint64(window.Seconds())}
+	conditions := make([]string, len(steps))
+	for i, step := range steps {
+		conditions[i], args = step.condition(args)
+		if i == 0 {
+			// Later steps may fall after to, as long as they are within the
+			// window, but the funnel itself must start in range.
+			conditions[i] = "(" + conditions[i] + " AND timestamp < ?)"
+			args = append(args, to)
+		}
+	}
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Event
+	}
+	args = append(args, orgID, from, to.Add(window), names)
+
+	query := fmt.Sprintf(`
+		SELECT level, count()
+		FROM (
+			SELECT user_id, windowFunnel(?)(toDateTime(timestamp), %s) AS level
+			FROM analytics_events
+			WHERE org_id = ? AND user_id != 0 AND timestamp >= ? AND timestamp < ? AND has(?, event)
+			GROUP BY user_id
+		)
+		WHERE level > 0
+		GROUP BY level
+	`, strings.Join(conditions, ", "))
+
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying funnel: %w", err)
+	}
+	defer rows.Close()
+
+	reached := make([]uint64, len(steps))
+	for rows.Next() {
+		var (
+			level uint8
+			users uint64
+		)
+		if err := rows.Scan(&level, &users); err != nil {
+			return nil, fmt.Errorf("error scanning funnel level: %w", err)
+		}
+		// Users at level n also reached every earlier step.
+		for i := 0; i < int(level) && i < len(reached); i++ {
+			reached[i] += users
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating funnel levels: %w", err)
+	}
+	return reached, nil
+}
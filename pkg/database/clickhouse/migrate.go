@@ -0,0 +1,275 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are numbered files in a directory, following the golang-migrate
+// naming used for Postgres: 000001_name.up.sql and 000001_name.down.sql.
+// Applied versions are appended to schema_migrations; the latest row wins.
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("clickhouse schema is dirty; fix the failed migration and force a version")
+
+type migration struct {
+	version uint64
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is the version recorded in schema_migrations.
+type MigrationStatus struct {
+	Version uint64
+	Dirty   bool
+}
+
+func (c *Client) ensureMigrationsTable(ctx context.Context) error {
+	return c.conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version UInt64,
+			dirty UInt8,
+			applied_at DateTime64(6)
+		)
+		ENGINE = MergeTree()
+		ORDER BY applied_at
+	`)
+}
+
+// MigrationVersion returns the current schema version, 0 when nothing has
+// been applied.
+func (c *Client) MigrationVersion(ctx context.Context) (MigrationStatus, error) {
+	if err := c.ensureMigrationsTable(ctx); err != nil {
+		return MigrationStatus{}, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	rows, err := c.conn.Query(ctx, "SELECT version, dirty FROM schema_migrations ORDER BY applied_at DESC LIMIT 1")
+	if err != nil {
+		return MigrationStatus{}, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var status MigrationStatus
+	if rows.Next() {
+		var dirty uint8
+		if err := rows.Scan(&status.Version, &dirty); err != nil {
+			return MigrationStatus{}, fmt.Errorf("error reading schema_migrations: %w", err)
+		}
+		status.Dirty = dirty == 1
+	}
+	return status, rows.Err()
+}
+
+// CheckMigrated returns an error unless migrations have been applied and the
+// schema is clean. Services call it on startup instead of creating tables.
+func (c *Client) CheckMigrated(ctx context.Context) error {
+	status, err := c.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w (version %d)", ErrDirty, status.Version)
+	}
+	if status.Version == 0 {
+		return errors.New("clickhouse schema has not been migrated; run make migrate-up")
+	}
+	return nil
+}
+
+func (c *Client) setMigrationVersion(ctx context.Context, version uint64, dirty bool) error {
+	var flag uint8
+	if dirty {
+		flag = 1
+	}
+	return c.conn.Exec(ctx,
+		"INSERT INTO schema_migrations (version, dirty, applied_at) VALUES (?, ?, ?)",
+		version, flag, time.Now())
+}
+
+// ForceMigrationVersion records version as applied and clean without running
+// anything, to recover from a failed migration.
+func (c *Client) ForceMigrationVersion(ctx context.Context, version uint64) error {
+	if err := c.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+	return c.setMigrationVersion(ctx, version, false)
+}
+
+// MigrateUp applies every migration in dir newer than the current version.
+func (c *Client) MigrateUp(ctx context.Context, dir string) error {
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w (version %d)", ErrDirty, status.Version)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= status.Version {
+			continue
+		}
+		if m.up == "" {
+			return fmt.Errorf("migration %d_%s has no up file", m.version, m.name)
+		}
+		if err := c.runMigration(ctx, m.version, m.name+".up", m.up, m.version); err != nil {
+			return err
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		log.Printf("ClickHouse schema is up to date at version %d", status.Version)
+	}
+	return nil
+}
+
+// MigrateDown reverts the given number of applied migrations.
+func (c *Client) MigrateDown(ctx context.Context, dir string, steps int) error {
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w (version %d)", ErrDirty, status.Version)
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if m.version > status.Version {
+			continue
+		}
+		if m.down == "" {
+			return fmt.Errorf("migration %d_%s has no down file", m.version, m.name)
+		}
+
+		var previous uint64
+		if i > 0 {
+			previous = migrations[i-1].version
+		}
+		if err := c.runMigration(ctx, m.version, m.name+".down", m.down, previous); err != nil {
+			return err
+		}
+		status.Version = previous
+		steps--
+	}
+	return nil
+}
+
+// runMigration marks the schema dirty at version, runs every statement and
+// records resultVersion as clean. A failure leaves the dirty mark in place.
+func (c *Client) runMigration(ctx context.Context, version uint64, name, path string, resultVersion uint64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := c.setMigrationVersion(ctx, version, true); err != nil {
+		return fmt.Errorf("error recording migration %d: %w", version, err)
+	}
+
+	started := time.Now()
+	for _, statement := range splitStatements(string(data)) {
+		if err := c.conn.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("error running migration %d_%s: %w", version, name, err)
+		}
+	}
+
+	if err := c.setMigrationVersion(ctx, resultVersion, false); err != nil {
+		return fmt.Errorf("error recording migration %d: %w", version, err)
+	}
+	log.Printf("Applied ClickHouse migration %d_%s in %s", version, name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[uint64]*migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if match[3] == "up" {
+			m.up = path
+		} else {
+			m.down = path
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// splitStatements splits a file into statements on semicolons that end a
+// line, since ClickHouse executes one statement per query. Comment lines are
+// dropped.
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			statements = append(statements, statement)
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
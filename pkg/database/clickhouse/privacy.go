@@ -0,0 +1,264 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-turbo/pkg/models"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// piiPropertyKeys are analytics property keys that identify a person
+var piiPropertyKeys = []string{"email", "ip_address", "user_agent", "referrer"}
+
+// pseudonymizedMetadata marks rows copied by PseudonymizeUserAnalytics. The
+// rollup views in migrations/clickhouse filter on this exact value.
+const pseudonymizedMetadata = `{"pseudonymized":true}`
+
+// mutationContext makes ALTER ... UPDATE/DELETE wait until the mutation has
+// been applied, so callers know the data is gone when they return.
+func mutationContext(ctx context.Context) context.Context {
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"mutations_sync": 1,
+	}))
+}
+
+// StreamUserAnalyticsEvents calls fn for every analytics event of the user
+// across all organizations, oldest first.
+func (c *Client) StreamUserAnalyticsEvents(ctx context.Context, userID uint64, fn func(models.AnalyticsEvent) error) error {
+	rows, err := c.conn.Query(ctx, `
+		SELECT id, timestamp, org_id, user_id, event, metadata, `+propertyColumns+`
+		FROM analytics_events
+		WHERE user_id = ?
+		ORDER BY timestamp
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error querying analytics events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AnalyticsEvent
+		var props propertyMaps
+		if err := rows.Scan(props.scanArgs(&event.ID, &event.Timestamp, &event.OrgID, &event.UserID, &event.Event, &event.Metadata)...); err != nil {
+			return fmt.Errorf("error scanning analytics event: %w", err)
+		}
+		event.Properties = props.properties()
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamUserAuditLogs calls fn for every audit log written by the user across
+// all organizations, oldest first.
+func (c *Client) StreamUserAuditLogs(ctx context.Context, userID uint64, fn func(models.AuditLog) error) error {
+	rows, err := c.conn.Query(ctx, `
+		SELECT id, timestamp, org_id, user_id, action, resource, resource_id, details, ip_address, user_agent
+		FROM audit_logs
+		WHERE user_id = ?
+		ORDER BY timestamp
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error querying audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var log models.AuditLog
+		if err := rows.Scan(&log.ID, &log.Timestamp, &log.OrgID, &log.UserID, &log.Action, &log.Resource,
+			&log.ResourceID, &log.Details, &log.IPAddress, &log.UserAgent); err != nil {
+			return fmt.Errorf("error scanning audit log: %w", err)
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamUserQuarantinedEvents calls fn for every quarantined event of the
+// user across all organizations, oldest first.
+func (c *Client) StreamUserQuarantinedEvents(ctx context.Context, userID uint64, fn func(QuarantinedEvent) error) error {
+	rows, err := c.conn.Query(ctx, `
+		SELECT received_at, timestamp, org_id, user_id, event, metadata, errors, `+propertyColumns+`
+		FROM analytics_events_quarantine
+		WHERE user_id = ?
+		ORDER BY received_at
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error querying quarantined events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q QuarantinedEvent
+		var props propertyMaps
+		if err := rows.Scan(props.scanArgs(&q.ReceivedAt, &q.Event.Timestamp, &q.Event.OrgID, &q.Event.UserID, &q.Event.Event,
+			&q.Event.Metadata, &q.Errors)...); err != nil {
+			return fmt.Errorf("error scanning quarantined event: %w", err)
+		}
+		q.Event.Properties = props.properties()
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// userScope matches the user's rows in one organization, or in every
+// organization when orgID is 0.
+func userScope(orgID, userID uint64) (string, []interface{}) {
+	if orgID == 0 {
+		return "user_id = ?", []interface{}{userID}
+	}
+	return "user_id = ? AND org_id = ?", []interface{}{userID, orgID}
+}
+
+// PseudonymizeUserAnalytics moves the user's events in orgID (0 for every
+// organization) to pseudonymID with identifying properties and metadata
+// removed. user_id is part of the sorting key and cannot be updated in place,
+// so rows are copied and the originals deleted. The copies carry
+// pseudonymizedMetadata so the rollup views, which already counted the
+// originals, skip them.
+func (c *Client) PseudonymizeUserAnalytics(ctx context.Context, orgID, userID, pseudonymID uint64) error {
+	scope, scopeArgs := userScope(orgID, userID)
+	args := append([]interface{}{pseudonymID, pseudonymizedMetadata, piiPropertyKeys, piiPropertyKeys, piiPropertyKeys, piiPropertyKeys}, scopeArgs...)
+	err := c.conn.Exec(ctx, `
+		INSERT INTO analytics_events (id, timestamp, org_id, user_id, event, metadata, `+propertyColumns+`)
+		SELECT id, timestamp, org_id, ?, event, ?,
+			mapFilter((k, v) -> NOT has(?, k), properties),
+			mapFilter((k, v) -> NOT has(?, k), properties_number),
+			mapFilter((k, v) -> NOT has(?, k), properties_bool),
+			mapFilter((k, v) -> NOT has(?, k), properties_array)
+		FROM analytics_events
+		WHERE `+scope, args...)
+	if err != nil {
+		return fmt.Errorf("error copying pseudonymized analytics events: %w", err)
+	}
+
+	if err := c.conn.Exec(mutationContext(ctx), `ALTER TABLE analytics_events DELETE WHERE `+scope, scopeArgs...); err != nil {
+		return fmt.Errorf("error deleting original analytics events: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserQuarantinedEvents removes the user's quarantined events in orgID
+// (0 for every organization). They were never counted anywhere, so unlike
+// analytics_events there is nothing to keep under a pseudonym.
+func (c *Client) DeleteUserQuarantinedEvents(ctx context.Context, orgID, userID uint64) error {
+	scope, scopeArgs := userScope(orgID, userID)
+	if err := c.conn.Exec(mutationContext(ctx), `ALTER TABLE analytics_events_quarantine DELETE WHERE `+scope, scopeArgs...); err != nil {
+		return fmt.Errorf("error deleting quarantined events: %w", err)
+	}
+	return nil
+}
+
+// GetUserEmailHistory returns every email address recorded in the user's
+// email change audit entries, requested or confirmed, in any organization.
+func (c *Client) GetUserEmailHistory(ctx context.Context, userID uint64) ([]string, error) {
+	rows, err := c.conn.Query(ctx, `
+		SELECT details
+		FROM audit_logs
+		WHERE user_id = ? AND resource = ? AND action IN (?, ?)
+	`, userID, models.ResourceProfile, models.ActionRequestEmailChange, models.ActionChangeEmail)
+	if err != nil {
+		return nil, fmt.Errorf("error querying email history: %w", err)
+	}
+	defer rows.Close()
+
+	var details []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, fmt.Errorf("error scanning email history: %w", err)
+		}
+		details = append(details, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating email history: %w", err)
+	}
+	return emailsFromChangeDetails(details), nil
+}
+
+// emailsFromChangeDetails extracts the old and new addresses from email
+// change details such as {"changes":{"email":{"old":"a@x","new":"b@x"}}}.
+func emailsFromChangeDetails(details []string) []string {
+	var emails []string
+	for _, d := range details {
+		var parsed struct {
+			Changes struct {
+				Email struct {
+					Old string `json:"old"`
+					New string `json:"new"`
+				} `json:"email"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal([]byte(d), &parsed); err != nil {
+			continue
+		}
+		for _, e := range []string{parsed.Changes.Email.Old, parsed.Changes.Email.New} {
+			if e != "" {
+				emails = append(emails, e)
+			}
+		}
+	}
+	return emails
+}
+
+// emailPattern builds a case-insensitive regular expression matching any of
+// the addresses as a whole address, or "" when there are none. The first
+// group is the character before the address, which replacements must keep.
+func emailPattern(emails []string) string {
+	seen := map[string]bool{}
+	var quoted []string
+	for _, e := range emails {
+		key := strings.ToLower(strings.TrimSpace(e))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		quoted = append(quoted, regexp.QuoteMeta(key))
+	}
+	if len(quoted) == 0 {
+		return ""
+	}
+	return `(?i)(^|[^a-z0-9._%+-])(` + strings.Join(quoted, "|") + `)\b`
+}
+
+// RedactUserAuditLogs keeps audit entries in orgID (0 for every
+// organization) but strips the client address and user agent from the
+// user's own entries, and replaces every address in emails, in any case,
+// wherever it appears in details, including entries written by other users.
+// Callers pass every address the user has had, see GetUserEmailHistory.
+func (c *Client) RedactUserAuditLogs(ctx context.Context, orgID, userID uint64, emails []string) error {
+	pattern := emailPattern(emails)
+	if pattern == "" {
+		return fmt.Errorf("error redacting audit logs: email is required")
+	}
+
+	orgCondition := ""
+	args := []interface{}{userID, userID, userID, pattern, pattern, userID, pattern}
+	if orgID != 0 {
+		orgCondition = " AND org_id = ?"
+		args = append(args, orgID)
+	}
+
+	err := c.conn.Exec(mutationContext(ctx), `
+		ALTER TABLE audit_logs UPDATE
+			ip_address = if(user_id = ?, '', ip_address),
+			user_agent = if(user_id = ?, '', user_agent),
+			details = if(user_id = ?,
+				replaceRegexpAll(replaceRegexpAll(details, ?, '\\1[redacted]'), '"(ip_address|user_agent)":"[^"]*"', '"\\1":"[redacted]"'),
+				replaceRegexpAll(details, ?, '\\1[redacted]'))
+		WHERE (user_id = ? OR match(details, ?))`+orgCondition, args...)
+	if err != nil {
+		return fmt.Errorf("error redacting audit logs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestEmailPatternCoversEmailChange(t *testing.T) {
+	details, err := json.Marshal(map[string]interface{}{
+		"changes": map[string]interface{}{
+			"email": map[string]interface{}{"old": "Alice@Example.com", "new": "alice.new@example.com"},
+		},
+		"ip_address": "203.0.113.7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := emailsFromChangeDetails([]string{string(details), "not json", `{"changes":{"name":{"old":"a","new":"b"}}}`})
+	if len(emails) != 2 {
+		t.Fatalf("emails = %v, want old and new address", emails)
+	}
+
+	pattern := emailPattern(append(emails, "ALICE.NEW@example.com"))
+	if pattern != `(?i)(^|[^a-z0-9._%+-])(alice@example\.com|alice\.new@example\.com)\b` {
+		t.Fatalf("pattern = %q", pattern)
+	}
+
+	re := regexp.MustCompile(pattern)
+	entries := map[string]string{
+		`{"target":"alice@example.com"}`:       `{"target":"[redacted]"}`,
+		`{"target":"ALICE@EXAMPLE.COM"}`:       `{"target":"[redacted]"}`,
+		`{"target":"Alice.New@Example.com"}`:   `{"target":"[redacted]"}`,
+		`{"target":"aliceXnew@example.com"}`:   `{"target":"aliceXnew@example.com"}`,
+		`{"target":"bob@example.com"}`:         `{"target":"bob@example.com"}`,
+		`{"target":"malice@example.com"}`:      `{"target":"malice@example.com"}`,
+		`{"target":"alice@example.company"}`:   `{"target":"alice@example.company"}`,
+		`alice@example.com, alice@example.com`: `[redacted], [redacted]`,
+	}
+	for in, want := range entries {
+		if got := re.ReplaceAllString(in, "${1}[redacted]"); got != want {
+			t.Errorf("redact(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestEmailPatternEmpty(t *testing.T) {
+	if p := emailPattern([]string{"", "  "}); p != "" {
+		t.Fatalf("pattern = %q, want empty", p)
+	}
+}
@@ -0,0 +1,200 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+// propertyColumns hold an event's properties: the string form of every
+// property, which older queries and the rollup views read, followed by
+// typed copies of the numeric, boolean and array properties.
+const propertyColumns = "properties, properties_number, properties_bool, properties_array"
+
+// propertyValues returns the values to insert into propertyColumns.
+func propertyValues(p models.Properties) []interface{} {
+	return []interface{}{p.Strings(), p.Numbers(), p.Bools(), p.Arrays()}
+}
+
+// propertyMaps receives propertyColumns when scanning.
+type propertyMaps struct {
+	strings map[string]string
+	numbers map[string]float64
+	bools   map[string]bool
+	arrays  map[string][]string
+}
+
+func (m *propertyMaps) properties() models.Properties {
+	return models.PropertiesFromColumns(m.strings, m.numbers, m.bools, m.arrays)
+}
+
+// scanArgs appends the targets for propertyColumns to dest.
+func (m *propertyMaps) scanArgs(dest ...interface{}) []interface{} {
+	return append(dest, &m.strings, &m.numbers, &m.bools, &m.arrays)
+}
+
+// propertyCondition renders a filter requiring property key to equal value,
+// comparing in the column of value's type, and appends its bound values to
+// args. Arrays match events whose array contains every listed element.
+func propertyCondition(key string, value interface{}, args []interface{}) (string, []interface{}) {
+	switch models.PropertyType(value) {
+	case models.PropertyTypeNumber:
+		n, _ := models.PropertyNumber(value)
+		return "(mapContains(properties_number, ?) AND properties_number[?] = ?)", append(args, key, key, n)
+	case models.PropertyTypeBoolean:
+		return "(mapContains(properties_bool, ?) AND properties_bool[?] = ?)", append(args, key, key, value)
+	case models.PropertyTypeArray:
+		return "hasAll(properties_array[?], ?)", append(args, key, models.Properties{key: value}.Arrays()[key])
+	}
+	return "properties[?] = ?", append(args, key, models.FormatProperty(value))
+}
+
+// propertiesCondition combines propertyCondition for every property, sorted
+// by key so the query text is stable.
+func propertiesCondition(properties models.Properties, args []interface{}) ([]string, []interface{}) {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		var part string
+		part, args = propertyCondition(k, properties[k], args)
+		parts = append(parts, part)
+	}
+	return parts, args
+}
+
+// PropertyStats summarizes a numeric property over the events that have it.
+type PropertyStats struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// GetPropertyStats summarizes numeric property key of the organization's
+// events in [from, to), optionally only those named eventName. Events where
+// key is missing or not a number are skipped.
+func (c *Client) GetPropertyStats(ctx context.Context, orgID uint64, eventName, key string, from, to time.Time) (*PropertyStats, error) {
+	query := `
+		SELECT
+			count(),
+			sum(v),
+			avgOrDefault(v),
+			minOrDefault(v),
+			maxOrDefault(v),
+			quantilesOrDefault(0.5, 0.9, 0.99)(v)
+		FROM (
+			SELECT properties_number[?] AS v
+			FROM analytics_events
+			WHERE org_id = ?
+				AND timestamp >= fromUnixTimestamp64Milli(toInt64(?))
+				AND timestamp < fromUnixTimestamp64Milli(toInt64(?))
+				AND mapContains(properties_number, ?)
+	`
+	args := []interface{}{key, orgID, from.UnixMilli(), to.UnixMilli(), key}
+	if eventName != "" {
+		query += " AND event = ?"
+		args = append(args, eventName)
+	}
+	query += ")"
+
+	var stats PropertyStats
+	var quantiles []float64
+	if err := c.conn.QueryRow(ctx, query, args...).Scan(
+		&stats.Count, &stats.Sum, &stats.Avg, &stats.Min, &stats.Max, &quantiles,
+	); err != nil {
+		return nil, fmt.Errorf("error querying property stats: %w", err)
+	}
+	if len(quantiles) == 3 {
+		stats.P50, stats.P90, stats.P99 = quantiles[0], quantiles[1], quantiles[2]
+	}
+	return &stats, nil
+}
+
+// PropertyValueCount is how many events had one value of a property.
+type PropertyValueCount struct {
+	Value interface{} `json:"value"`
+	Type  string      `json:"type"`
+	Count uint64      `json:"count"`
+}
+
+// GetPropertyValues returns the most common values of property key among the
+// organization's events in [from, to), optionally only those named
+// eventName. Values keep their type, so 200 and "200" are counted apart.
+func (c *Client) GetPropertyValues(ctx context.Context, orgID uint64, eventName, key string, from, to time.Time, limit int) ([]PropertyValueCount, error) {
+	query := `
+		SELECT
+			properties[?] AS value,
+			multiIf(
+				mapContains(properties_number, ?), 'number',
+				mapContains(properties_bool, ?), 'boolean',
+				mapContains(properties_array, ?), 'array',
+				'string'
+			) AS type,
+			count() AS n
+		FROM analytics_events
+		WHERE org_id = ?
+			AND timestamp >= fromUnixTimestamp64Milli(toInt64(?))
+			AND timestamp < fromUnixTimestamp64Milli(toInt64(?))
+			AND mapContains(properties, ?)
+	`
+	args := []interface{}{key, key, key, key, orgID, from.UnixMilli(), to.UnixMilli(), key}
+	if eventName != "" {
+		query += " AND event = ?"
+		args = append(args, eventName)
+	}
+	query += " GROUP BY value, type ORDER BY n DESC, value LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying property values: %w", err)
+	}
+	defer rows.Close()
+
+	values := []PropertyValueCount{}
+	for rows.Next() {
+		var raw string
+		var v PropertyValueCount
+		if err := rows.Scan(&raw, &v.Type, &v.Count); err != nil {
+			return nil, fmt.Errorf("error scanning property value: %w", err)
+		}
+		v.Value = parsePropertyValue(v.Type, raw)
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// parsePropertyValue turns the string form of a property back into a value
+// of type t.
+func parsePropertyValue(t, raw string) interface{} {
+	switch t {
+	case models.PropertyTypeNumber:
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n
+		}
+	case models.PropertyTypeBoolean:
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	case models.PropertyTypeArray:
+		var elems []interface{}
+		if err := json.Unmarshal([]byte(raw), &elems); err == nil {
+			return elems
+		}
+	}
+	return raw
+}
@@ -0,0 +1,84 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+// QuarantinedEvent is an event held back by schema validation, with the
+// reasons it failed.
+type QuarantinedEvent struct {
+	ReceivedAt time.Time             `json:"received_at"`
+	Event      models.AnalyticsEvent `json:"event"`
+	Errors     []string              `json:"errors"`
+}
+
+// InsertQuarantinedEvents stores events that failed validation.
+func (c *Client) InsertQuarantinedEvents(ctx context.Context, events []QuarantinedEvent) error {
+	batch, err := c.conn.PrepareBatch(ctx, `
+		INSERT INTO analytics_events_quarantine (received_at, timestamp, org_id, user_id, event, metadata, errors, `+propertyColumns+`)
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing quarantine batch: %w", err)
+	}
+	defer batch.Abort()
+
+	for _, q := range events {
+		if err := batch.Append(append([]interface{}{
+			q.ReceivedAt,
+			q.Event.Timestamp,
+			q.Event.OrgID,
+			q.Event.UserID,
+			q.Event.Event,
+			q.Event.Metadata,
+			q.Errors,
+		}, propertyValues(q.Event.Properties)...)...); err != nil {
+			return fmt.Errorf("error appending quarantined event: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("error inserting quarantined events: %w", err)
+	}
+	return nil
+}
+
+// GetQuarantinedEvents returns the organization's most recently quarantined
+// events received in [from, to), optionally only those named eventName.
+func (c *Client) GetQuarantinedEvents(ctx context.Context, orgID uint64, eventName string, from, to time.Time, limit int) ([]QuarantinedEvent, error) {
+	query := `
+		SELECT received_at, timestamp, org_id, user_id, event, metadata, errors, ` + propertyColumns + `
+		FROM analytics_events_quarantine
+		WHERE org_id = ?
+			AND received_at >= fromUnixTimestamp64Milli(toInt64(?))
+			AND received_at < fromUnixTimestamp64Milli(toInt64(?))
+	`
+	args := []interface{}{orgID, from.UnixMilli(), to.UnixMilli()}
+	if eventName != "" {
+		query += " AND event = ?"
+		args = append(args, eventName)
+	}
+	query += " ORDER BY received_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying quarantined events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []QuarantinedEvent{}
+	for rows.Next() {
+		var q QuarantinedEvent
+		var props propertyMaps
+		if err := rows.Scan(props.scanArgs(&q.ReceivedAt, &q.Event.Timestamp, &q.Event.OrgID, &q.Event.UserID, &q.Event.Event,
+			&q.Event.Metadata, &q.Errors)...); err != nil {
+			return nil, fmt.Errorf("error scanning quarantined event: %w", err)
+		}
+		q.Event.Properties = props.properties()
+		events = append(events, q)
+	}
+	return events, rows.Err()
+}
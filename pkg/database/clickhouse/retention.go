@@ -0,0 +1,134 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RetentionPolicy controls how long rows stay in a table. Rows older than
+// Days are deleted, or moved to ColdVolume when one is set. Moving requires
+// the table to use a storage policy that contains the volume. Retention is
+// environment specific, so it is applied after migrations rather than in them.
+type RetentionPolicy struct {
+	Days          int // 0 keeps rows forever
+	ColdVolume    string
+	StoragePolicy string
+}
+
+var (
+	DefaultAnalyticsRetention = RetentionPolicy{Days: 90}
+	DefaultAuditRetention     = RetentionPolicy{Days: 7 * 365}
+)
+
+// AnalyticsRetentionFromEnv reads CLICKHOUSE_ANALYTICS_TTL_DAYS,
+// CLICKHOUSE_ANALYTICS_COLD_VOLUME and CLICKHOUSE_ANALYTICS_STORAGE_POLICY.
+func AnalyticsRetentionFromEnv() RetentionPolicy {
+	return retentionFromEnv("CLICKHOUSE_ANALYTICS_", DefaultAnalyticsRetention)
+}
+
+// AuditRetentionFromEnv reads CLICKHOUSE_AUDIT_TTL_DAYS,
+// CLICKHOUSE_AUDIT_COLD_VOLUME and CLICKHOUSE_AUDIT_STORAGE_POLICY.
+func AuditRetentionFromEnv() RetentionPolicy {
+	return retentionFromEnv("CLICKHOUSE_AUDIT_", DefaultAuditRetention)
+}
+
+func retentionFromEnv(prefix string, policy RetentionPolicy) RetentionPolicy {
+	if v := os.Getenv(prefix + "TTL_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Printf("Ignoring invalid %sTTL_DAYS %q", prefix, v)
+		} else {
+			policy.Days = days
+		}
+	}
+	if v := os.Getenv(prefix + "COLD_VOLUME"); v != "" {
+		policy.ColdVolume = v
+	}
+	if v := os.Getenv(prefix + "STORAGE_POLICY"); v != "" {
+		policy.StoragePolicy = v
+	}
+	return policy
+}
+
+func (p RetentionPolicy) ttlExpression() string {
+	if p.Days == 0 {
+		return ""
+	}
+	expr := fmt.Sprintf("toDateTime(timestamp) + INTERVAL %d DAY", p.Days)
+	if p.ColdVolume != "" {
+		return expr + " TO VOLUME " + quoteString(p.ColdVolume)
+	}
+	return expr + " DELETE"
+}
+
+// matches reports whether the table definition already carries this policy's
+// TTL. ClickHouse normalizes "INTERVAL n DAY" to "toIntervalDay(n)".
+func (p RetentionPolicy) matches(createQuery string) bool {
+	hasTTL := strings.Contains(createQuery, " TTL ")
+	if p.Days == 0 {
+		return !hasTTL
+	}
+	if !hasTTL || !strings.Contains(createQuery, fmt.Sprintf("toIntervalDay(%d)", p.Days)) {
+		return false
+	}
+	if p.ColdVolume != "" {
+		return strings.Contains(createQuery, "TO VOLUME "+quoteString(p.ColdVolume))
+	}
+	return !strings.Contains(createQuery, "TO VOLUME")
+}
+
+// ApplyRetention brings a table's TTL and storage policy in line with the
+// policy. Changing a TTL rewrites data, so nothing is altered when the table
+// already matches.
+func (c *Client) ApplyRetention(ctx context.Context, table string, policy RetentionPolicy) error {
+	var createQuery, storagePolicy string
+	err := c.conn.QueryRow(ctx,
+		"SELECT create_table_query, storage_policy FROM system.tables WHERE database = currentDatabase() AND name = ?",
+		table).Scan(&createQuery, &storagePolicy)
+	if err != nil {
+		return fmt.Errorf("error reading %s definition: %w", table, err)
+	}
+
+	if policy.StoragePolicy != "" && policy.StoragePolicy != storagePolicy {
+		// The new policy must contain every disk of the old one
+		query := fmt.Sprintf("ALTER TABLE %s MODIFY SETTING storage_policy = %s", table, quoteString(policy.StoragePolicy))
+		if err := c.conn.Exec(ctx, query); err != nil {
+			return fmt.Errorf("error changing %s storage policy: %w", table, err)
+		}
+	}
+
+	if policy.matches(createQuery) {
+		return nil
+	}
+
+	var query string
+	if policy.Days == 0 {
+		query = fmt.Sprintf("ALTER TABLE %s REMOVE TTL", table)
+	} else {
+		query = fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", table, policy.ttlExpression())
+	}
+	if err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("error applying %s retention: %w", table, err)
+	}
+	log.Printf("Applied retention to %s: %s", table, describeRetention(policy))
+	return nil
+}
+
+func describeRetention(p RetentionPolicy) string {
+	switch {
+	case p.Days == 0:
+		return "keep forever"
+	case p.ColdVolume != "":
+		return fmt.Sprintf("move to volume %s after %d days", p.ColdVolume, p.Days)
+	default:
+		return fmt.Sprintf("delete after %d days", p.Days)
+	}
+}
+
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
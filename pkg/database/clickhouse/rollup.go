@@ -0,0 +1,267 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// The rollup tables are filled by materialized views (see
+// migrations/clickhouse/000003_create_rollups, and 000006_api_latency_by_route
+// for api_latency_hourly). They are bucketed by UTC hour
+// or day, so they can answer a query only when both ends of its range fall on
+// a bucket boundary. Other ranges are answered from analytics_events.
+
+// EventCount is the number of events with one name in one hour.
+type EventCount struct {
+	Hour   time.Time `json:"hour"`
+	Event  string    `json:"event"`
+	Events uint64    `json:"events"`
+	Users  uint64    `json:"users"`
+}
+
+// DailyActiveUsers is the number of distinct users seen on one UTC day.
+type DailyActiveUsers struct {
+	Day   time.Time `json:"day"`
+	Users uint64    `json:"users"`
+}
+
+// Percentiles are the p50, p90 and p99 of a measurement.
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+func percentilesOf(values []float64) Percentiles {
+	if len(values) != 3 {
+		return Percentiles{}
+	}
+	return Percentiles{P50: values[0], P90: values[1], P99: values[2]}
+}
+
+// EndpointLatency summarizes API requests to one route, or to one path for
+// requests recorded before routes were. Errors counts 5xx responses.
+// Durations are in milliseconds and sizes in bytes.
+type EndpointLatency struct {
+	Hour          *time.Time  `json:"hour,omitempty"`
+	Method        string      `json:"method"`
+	Route         string      `json:"route"`
+	Requests      uint64      `json:"requests"`
+	Errors        uint64      `json:"errors"`
+	DurationMs    Percentiles `json:"duration_ms"`
+	RequestBytes  Percentiles `json:"request_bytes"`
+	ResponseBytes Percentiles `json:"response_bytes"`
+}
+
+func hourAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(time.Hour))
+}
+
+func dayAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(24 * time.Hour))
+}
+
+// GetHourlyEventCounts returns per-hour event counts for the organization in
+// [from, to), ordered by hour and event name.
+func (c *Client) GetHourlyEventCounts(ctx context.Context, orgID uint64, from, to time.Time) ([]EventCount, error) {
+	query := `
+		SELECT toStartOfHour(timestamp, 'UTC') AS hour, event, count(), uniq(user_id)
+		FROM analytics_events
+		WHERE org_id = ? AND timestamp >= ? AND timestamp < ?
+		GROUP BY hour, event
+		ORDER BY hour, event
+	`
+	if hourAligned(from) && hourAligned(to) {
+		query = `
+			SELECT hour, event, countMerge(events), uniqMerge(users)
+			FROM analytics_events_hourly
+			WHERE org_id = ? AND hour >= ? AND hour < ?
+			GROUP BY hour, event
+			ORDER BY hour, event
+		`
+	}
+
+	rows, err := c.conn.Query(ctx, query, orgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error querying hourly event counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []EventCount{}
+	for rows.Next() {
+		var count EventCount
+		if err := rows.Scan(&count.Hour, &count.Event, &count.Events, &count.Users); err != nil {
+			return nil, fmt.Errorf("error scanning hourly event count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hourly event counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetDailyActiveUsers returns distinct signed-in users per UTC day for the
+// organization in [from, to), oldest first.
+func (c *Client) GetDailyActiveUsers(ctx context.Context, orgID uint64, from, to time.Time) ([]DailyActiveUsers, error) {
+	query := `
+		SELECT toDate(timestamp, 'UTC') AS day, uniq(user_id)
+		FROM analytics_events
+		WHERE org_id = ? AND user_id != 0 AND timestamp >= ? AND timestamp < ?
+		GROUP BY day
+		ORDER BY day
+	`
+	if dayAligned(from) && dayAligned(to) {
+		query = `
+			SELECT day, uniqMerge(users)
+			FROM daily_active_users
+			WHERE org_id = ? AND day >= toDate(?, 'UTC') AND day < toDate(?, 'UTC')
+			GROUP BY day
+			ORDER BY day
+		`
+	}
+
+	rows, err := c.conn.Query(ctx, query, orgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily active users: %w", err)
+	}
+	defer rows.Close()
+
+	days := []DailyActiveUsers{}
+	for rows.Next() {
+		var day DailyActiveUsers
+		if err := rows.Scan(&day.Day, &day.Users); err != nil {
+			return nil, fmt.Errorf("error scanning daily active users: %w", err)
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily active users: %w", err)
+	}
+	return days, nil
+}
+
+// latencyColumns aggregate api_request events, or the api_latency_hourly
+// rollup, into the columns scanned by scanEndpointLatency.
+const (
+	latencyColumns = `
+		count(),
+		countIf(properties_number['status_code'] >= 500),
+		quantilesTDigest(0.5, 0.9, 0.99)(properties_number['duration_ms']) AS duration_ms,
+		quantilesTDigestIf(0.5, 0.9, 0.99)(properties_number['request_bytes'], mapContains(properties_number, 'request_bytes')),
+		quantilesTDigestIf(0.5, 0.9, 0.99)(properties_number['response_bytes'], mapContains(properties_number, 'response_bytes'))
+	`
+	latencyRollupColumns = `
+		countMerge(requests),
+		countIfMerge(errors),
+		quantilesTDigestMerge(0.5, 0.9, 0.99)(duration_ms) AS p,
+		quantilesTDigestIfMerge(0.5, 0.9, 0.99)(request_bytes),
+		quantilesTDigestIfMerge(0.5, 0.9, 0.99)(response_bytes)
+	`
+	latencyRoute = `if(properties['route'] != '', properties['route'], properties['endpoint'])`
+)
+
+func scanEndpointLatency(rows driver.Rows, dest ...interface{}) (EndpointLatency, error) {
+	var (
+		endpoint                      EndpointLatency
+		duration, requests, responses []float64
+	)
+	dest = append(dest, &endpoint.Method, &endpoint.Route, &endpoint.Requests, &endpoint.Errors, &duration, &requests, &responses)
+	if err := rows.Scan(dest...); err != nil {
+		return EndpointLatency{}, err
+	}
+	endpoint.DurationMs = percentilesOf(duration)
+	endpoint.RequestBytes = percentilesOf(requests)
+	endpoint.ResponseBytes = percentilesOf(responses)
+	return endpoint, nil
+}
+
+// GetEndpointLatency returns request counts, latency and size percentiles
+// per route for the organization in [from, to), slowest p99 first. Only
+// requests recorded with a duration are included.
+func (c *Client) GetEndpointLatency(ctx context.Context, orgID uint64, from, to time.Time) ([]EndpointLatency, error) {
+	query := `
+		SELECT properties['method'] AS method, ` + latencyRoute + ` AS route, ` + latencyColumns + `
+		FROM analytics_events
+		WHERE org_id = ? AND event = 'api_request' AND mapContains(properties_number, 'duration_ms')
+			AND timestamp >= ? AND timestamp < ?
+		GROUP BY method, route
+		ORDER BY duration_ms[3] DESC
+	`
+	if hourAligned(from) && hourAligned(to) {
+		query = `
+			SELECT method, route, ` + latencyRollupColumns + `
+			FROM api_latency_hourly
+			WHERE org_id = ? AND hour >= ? AND hour < ?
+			GROUP BY method, route
+			ORDER BY p[3] DESC
+		`
+	}
+
+	rows, err := c.conn.Query(ctx, query, orgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error querying endpoint latency: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []EndpointLatency{}
+	for rows.Next() {
+		endpoint, err := scanEndpointLatency(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning endpoint latency: %w", err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating endpoint latency: %w", err)
+	}
+	return endpoints, nil
+}
+
+// GetRouteLatency returns one route's request counts, latency and size
+// percentiles per UTC hour in [from, to), oldest first.
+func (c *Client) GetRouteLatency(ctx context.Context, orgID uint64, method, route string, from, to time.Time) ([]EndpointLatency, error) {
+	query := `
+		SELECT toStartOfHour(timestamp, 'UTC') AS hour, properties['method'] AS method, ` + latencyRoute + ` AS route, ` + latencyColumns + `
+		FROM analytics_events
+		WHERE org_id = ? AND event = 'api_request' AND mapContains(properties_number, 'duration_ms')
+			AND timestamp >= ? AND timestamp < ?
+			AND method = ? AND route = ?
+		GROUP BY hour, method, route
+		ORDER BY hour
+	`
+	if hourAligned(from) && hourAligned(to) {
+		query = `
+			SELECT hour, method, route, ` + latencyRollupColumns + `
+			FROM api_latency_hourly
+			WHERE org_id = ? AND hour >= ? AND hour < ?
+				AND method = ? AND route = ?
+			GROUP BY hour, method, route
+			ORDER BY hour
+		`
+	}
+
+	rows, err := c.conn.Query(ctx, query, orgID, from, to, method, route)
+	if err != nil {
+		return nil, fmt.Errorf("error querying route latency: %w", err)
+	}
+	defer rows.Close()
+
+	hours := []EndpointLatency{}
+	for rows.Next() {
+		var hour time.Time
+		endpoint, err := scanEndpointLatency(rows, &hour)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning route latency: %w", err)
+		}
+		endpoint.Hour = &hour
+		hours = append(hours, endpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating route latency: %w", err)
+	}
+	return hours, nil
+}
@@ -0,0 +1,229 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+// Analytics sessions are reconstructed at query time: a user's events are
+// ordered by time and a new session starts whenever the gap since their
+// previous event exceeds the inactivity timeout. Nothing is stored, so the
+// timeout can change per query and applies to historical events too. Only
+// events inside the queried range are considered, so a session that began
+// before the range starts at its first event in range.
+
+// DefaultSessionTimeout is the usual inactivity gap that ends a session.
+const DefaultSessionTimeout = 30 * time.Minute
+
+// maxSessionEvents bounds the size of a session timeline.
+const maxSessionEvents = 5000
+
+// ErrInvalidSessionID is returned for session IDs not produced by this package.
+var ErrInvalidSessionID = errors.New("invalid session ID")
+
+// AnalyticsSession summarizes one reconstructed session. Pages counts
+// page_view events; EntryPage and ExitPage are the first and last pages viewed.
+type AnalyticsSession struct {
+	ID              string    `json:"id"`
+	UserID          uint64    `json:"user_id"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Events          uint64    `json:"events"`
+	Pages           uint64    `json:"pages"`
+	EntryPage       string    `json:"entry_page"`
+	ExitPage        string    `json:"exit_page"`
+}
+
+// SessionSummary aggregates the sessions of an organization. A bounce is a
+// session with at most one page view.
+type SessionSummary struct {
+	Sessions              uint64   `json:"sessions"`
+	Users                 uint64   `json:"users"`
+	AvgDurationSeconds    float64  `json:"avg_duration_seconds"`
+	MedianDurationSeconds float64  `json:"median_duration_seconds"`
+	AvgPages              float64  `json:"avg_pages"`
+	BounceRate            float64  `json:"bounce_rate"`
+	TopEntryPages         []string `json:"top_entry_pages"`
+	TopExitPages          []string `json:"top_exit_pages"`
+}
+
+// SessionID identifies a session by its user and the millisecond its first
+// event happened.
+func SessionID(userID uint64, start time.Time) string {
+	return strconv.FormatUint(userID, 10) + "-" + strconv.FormatInt(start.UnixMilli(), 10)
+}
+
+// ParseSessionID splits a session ID produced by SessionID.
+func ParseSessionID(id string) (uint64, time.Time, error) {
+	user, start, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, time.Time{}, ErrInvalidSessionID
+	}
+	userID, err := strconv.ParseUint(user, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidSessionID
+	}
+	ms, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidSessionID
+	}
+	return userID, time.UnixMilli(ms).UTC(), nil
+}
+
+// sessionsQuery returns a subquery with one row per session and the values to
+// bind to it. userID 0 includes every signed-in user of the organization.
+func sessionsQuery(orgID, userID uint64, timeout time.Duration, from, to time.Time) (string, []interface{}) {
+	args := []interface{}{timeout.Milliseconds(), orgID}
+	userFilter := "user_id != 0"
+	if userID != 0 {
+		userFilter = "user_id = ?"
+		args = append(args, userID)
+	}
+	args = append(args, from, to)
+
+	return fmt.Sprintf(`
+		SELECT
+			user_id,
+			min(timestamp) AS started_at,
+			max(timestamp) AS ended_at,
+			count() AS events,
+			countIf(event = 'page_view') AS pages,
+			argMinIf(properties['page'], timestamp, event = 'page_view') AS entry_page,
+			argMaxIf(properties['page'], timestamp, event = 'page_view') AS exit_page
+		FROM (
+			SELECT
+				user_id, timestamp, event, properties,
+				sum(is_new) OVER (PARTITION BY user_id ORDER BY timestamp ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS session
+			FROM (
+				SELECT
+					user_id, timestamp, event, properties,
+					toUnixTimestamp64Milli(timestamp) - lagInFrame(toUnixTimestamp64Milli(timestamp), 1, 0)
+						OVER (PARTITION BY user_id ORDER BY timestamp ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) > ? AS is_new
+				FROM analytics_events
+				WHERE org_id = ? AND %s AND timestamp >= ? AND timestamp < ?
+			)
+		)
+		GROUP BY user_id, session
+	`, userFilter), args
+}
+
+// GetUserAnalyticsSessions returns the user's sessions that started in
+// [from, to), newest first.
+func (c *Client) GetUserAnalyticsSessions(ctx context.Context, orgID, userID uint64, timeout time.Duration, from, to time.Time) ([]AnalyticsSession, error) {
+	sessions, args := sessionsQuery(orgID, userID, timeout, from, to)
+	rows, err := c.conn.Query(ctx, `
+		SELECT user_id, started_at, ended_at, events, pages, entry_page, exit_page
+		FROM (`+sessions+`)
+		ORDER BY started_at DESC
+		LIMIT 1000
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying analytics sessions: %w", err)
+	}
+	defer rows.Close()
+
+	result := []AnalyticsSession{}
+	for rows.Next() {
+		var s AnalyticsSession
+		if err := rows.Scan(&s.UserID, &s.Start, &s.End, &s.Events, &s.Pages, &s.EntryPage, &s.ExitPage); err != nil {
+			return nil, fmt.Errorf("error scanning analytics session: %w", err)
+		}
+		s.ID = SessionID(s.UserID, s.Start)
+		s.DurationSeconds = s.End.Sub(s.Start).Seconds()
+		result = append(result, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating analytics sessions: %w", err)
+	}
+	return result, nil
+}
+
+// GetSessionSummary aggregates every session in the organization that
+// started in [from, to).
+func (c *Client) GetSessionSummary(ctx context.Context, orgID uint64, timeout time.Duration, from, to time.Time) (SessionSummary, error) {
+	sessions, args := sessionsQuery(orgID, 0, timeout, from, to)
+
+	var summary SessionSummary
+	err := c.conn.QueryRow(ctx, `
+		SELECT
+			count(),
+			uniqExact(user_id),
+			ifNotFinite(avg(duration), 0),
+			ifNotFinite(quantile(0.5)(duration), 0),
+			ifNotFinite(avg(pages), 0),
+			ifNotFinite(countIf(pages <= 1) / count(), 0),
+			topKIf(10)(entry_page, entry_page != ''),
+			topKIf(10)(exit_page, exit_page != '')
+		FROM (
+			SELECT
+				*,
+				(toUnixTimestamp64Milli(ended_at) - toUnixTimestamp64Milli(started_at)) / 1000 AS duration
+			FROM (`+sessions+`)
+		)
+	`, args...).Scan(
+		&summary.Sessions,
+		&summary.Users,
+		&summary.AvgDurationSeconds,
+		&summary.MedianDurationSeconds,
+		&summary.AvgPages,
+		&summary.BounceRate,
+		&summary.TopEntryPages,
+		&summary.TopExitPages,
+	)
+	if err != nil {
+		return SessionSummary{}, fmt.Errorf("error querying session summary: %w", err)
+	}
+	return summary, nil
+}
+
+// GetSessionTimeline returns the events of a session in order: the user's
+// events from the session start until the first gap longer than timeout.
+// The result is empty when no event happened at the session start.
+func (c *Client) GetSessionTimeline(ctx context.Context, orgID uint64, sessionID string, timeout time.Duration) ([]models.AnalyticsEvent, error) {
+	userID, start, err := ParseSessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound parameters are sent with second precision, so the start is passed
+	// as milliseconds.
+	rows, err := c.conn.Query(ctx, `
+		SELECT id, timestamp, org_id, user_id, event, metadata, `+propertyColumns+`
+		FROM analytics_events
+		WHERE org_id = ? AND user_id = ? AND timestamp >= fromUnixTimestamp64Milli(toInt64(?))
+		ORDER BY timestamp
+		LIMIT ?
+	`, orgID, userID, start.UnixMilli(), maxSessionEvents)
+	if err != nil {
+		return nil, fmt.Errorf("error querying session timeline: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AnalyticsEvent{}
+	for rows.Next() {
+		var event models.AnalyticsEvent
+		var props propertyMaps
+		if err := rows.Scan(props.scanArgs(&event.ID, &event.Timestamp, &event.OrgID, &event.UserID, &event.Event, &event.Metadata)...); err != nil {
+			return nil, fmt.Errorf("error scanning session event: %w", err)
+		}
+		event.Properties = props.properties()
+		if len(events) == 0 && !event.Timestamp.Equal(start) {
+			break
+		}
+		if len(events) > 0 && event.Timestamp.Sub(events[len(events)-1].Timestamp) > timeout {
+			break
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session timeline: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,145 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+const (
+	// DefaultWriterBatchSize is how many events trigger a flush before the
+	// interval is up.
+	DefaultWriterBatchSize = 5000
+	// DefaultWriterFlushInterval bounds how long an event waits to be written.
+	DefaultWriterFlushInterval = 500 * time.Millisecond
+)
+
+// ErrWriterClosed is returned by Write once the writer has stopped.
+var ErrWriterClosed = errors.New("analytics writer closed")
+
+// InsertAnalyticsEvents writes events in a single batch insert.
+func (c *Client) InsertAnalyticsEvents(ctx context.Context, events []models.AnalyticsEvent) error {
+	batch, err := c.conn.PrepareBatch(ctx, `
+		INSERT INTO analytics_events (timestamp, org_id, user_id, event, metadata, `+propertyColumns+`)
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing analytics batch: %w", err)
+	}
+	defer batch.Abort()
+
+	for _, event := range events {
+		if err := batch.Append(append([]interface{}{
+			event.Timestamp,
+			event.OrgID,
+			event.UserID,
+			event.Event,
+			event.Metadata,
+		}, propertyValues(event.Properties)...)...); err != nil {
+			return fmt.Errorf("error appending analytics event: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("error inserting analytics batch: %w", err)
+	}
+	return nil
+}
+
+type writeRequest struct {
+	events []models.AnalyticsEvent
+	done   chan error
+}
+
+// AnalyticsWriter coalesces events from concurrent callers into batch
+// inserts, which ClickHouse handles far better than one insert per event.
+type AnalyticsWriter struct {
+	client        *Client
+	batchSize     int
+	flushInterval time.Duration
+	requests      chan writeRequest
+	stopped       chan struct{}
+}
+
+func NewAnalyticsWriter(client *Client, batchSize int, flushInterval time.Duration) *AnalyticsWriter {
+	return &AnalyticsWriter{
+		client:        client,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		requests:      make(chan writeRequest),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// Write queues events and waits until the batch holding them is stored, so
+// a nil error means the events were written.
+func (w *AnalyticsWriter) Write(ctx context.Context, events []models.AnalyticsEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	req := writeRequest{events: events, done: make(chan error, 1)}
+	select {
+	case w.requests <- req:
+	case <-w.stopped:
+		return ErrWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Once queued the events are written even if the caller gives up
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run flushes batches until ctx is cancelled, then writes whatever is still
+// pending.
+func (w *AnalyticsWriter) Run(ctx context.Context) {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	var pending []writeRequest
+	size := 0
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		events := make([]models.AnalyticsEvent, 0, size)
+		for _, req := range pending {
+			events = append(events, req.events...)
+		}
+
+		// Use a fresh context so the final flush survives shutdown
+		flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := w.client.InsertAnalyticsEvents(flushCtx, events)
+		cancel()
+
+		for _, req := range pending {
+			req.done <- err
+		}
+		pending, size = nil, 0
+	}
+
+	for {
+		select {
+		case req := <-w.requests:
+			pending = append(pending, req)
+			size += len(req.events)
+			if size >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			return
+		}
+	}
+}
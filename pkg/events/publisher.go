@@ -10,6 +10,53 @@ import (
 	"go-turbo/pkg/queue"
 )
 
+type orgIDKey struct{}
+
+// WithOrgID attaches the caller's organization to ctx so published events are
+// stamped with it.
+func WithOrgID(ctx context.Context, orgID uint64) context.Context {
+	return context.WithValue(ctx, orgIDKey{}, orgID)
+}
+
+// OrgIDFromContext returns the organization attached by WithOrgID, or 0.
+func OrgIDFromContext(ctx context.Context) uint64 {
+	orgID, _ := ctx.Value(orgIDKey{}).(uint64)
+	return orgID
+}
+
+// Events are published to a topic exchange so the storage queues and live
+// subscribers each receive a copy.
+const (
+	Exchange            = "events"
+	RoutingKeyAnalytics = "analytics"
+	RoutingKeyAudit     = "audit"
+
+	AnalyticsQueue = "analytics_queue"
+	AuditLogsQueue = "audit_logs_queue"
+)
+
+// DeclareTopology declares the events exchange and the durable storage queues
+// bound to it. Every service that publishes or consumes events calls it at
+// startup so no messages are dropped for lack of a binding.
+func DeclareTopology(rabbitmq *queue.RabbitMQ) error {
+	if err := rabbitmq.DeclareExchange(Exchange); err != nil {
+		return err
+	}
+	bindings := map[string]string{
+		AnalyticsQueue: RoutingKeyAnalytics,
+		AuditLogsQueue: RoutingKeyAudit,
+	}
+	for name, key := range bindings {
+		if err := rabbitmq.DeclareQueue(name); err != nil {
+			return err
+		}
+		if err := rabbitmq.BindQueue(name, key, Exchange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type Publisher struct {
 	rabbitmq *queue.RabbitMQ
 }
@@ -22,23 +69,29 @@ func (p *Publisher) PublishAnalytics(ctx context.Context, event models.Analytics
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
-	return p.rabbitmq.Publish("analytics_queue", event)
+	if event.OrgID == 0 {
+		event.OrgID = OrgIDFromContext(ctx)
+	}
+	return p.rabbitmq.PublishTo(Exchange, RoutingKeyAnalytics, event)
 }
 
 func (p *Publisher) PublishAuditLog(ctx context.Context, log models.AuditLog) error {
 	if log.Timestamp.IsZero() {
 		log.Timestamp = time.Now()
 	}
-	return p.rabbitmq.Publish("audit_logs_queue", log)
+	if log.OrgID == 0 {
+		log.OrgID = OrgIDFromContext(ctx)
+	}
+	return p.rabbitmq.PublishTo(Exchange, RoutingKeyAudit, log)
 }
 
 // Authentication Events
-func (p *Publisher) TrackLogin(ctx context.Context, userID uint64, success bool, metadata map[string]string) error {
+func (p *Publisher) TrackLogin(ctx context.Context, userID uint64, success bool, metadata models.Properties) error {
 	event := models.AnalyticsEvent{
 		UserID: userID,
 		Event:  models.EventUserLogin,
-		Properties: map[string]string{
-			"success": strconv.FormatBool(success),
+		Properties: models.Properties{
+			"success": success,
 		},
 	}
 	if metadata != nil {
@@ -73,7 +126,7 @@ func (p *Publisher) TrackLogout(ctx context.Context, userID uint64) error {
 	return p.LogUserAction(ctx, userID, models.ActionLogout, models.ResourceUser, strconv.FormatUint(userID, 10), nil)
 }
 
-func (p *Publisher) TrackRegistration(ctx context.Context, userID uint64, metadata map[string]string) error {
+func (p *Publisher) TrackRegistration(ctx context.Context, userID uint64, metadata models.Properties) error {
 	event := models.AnalyticsEvent{
 		UserID:     userID,
 		Event:      models.EventUserSignup,
@@ -89,8 +142,8 @@ func (p *Publisher) TrackRegistration(ctx context.Context, userID uint64, metada
 }
 
 // Page View Events
-func (p *Publisher) TrackPageView(ctx context.Context, userID uint64, page string, metadata map[string]string) error {
-	properties := map[string]string{
+func (p *Publisher) TrackPageView(ctx context.Context, userID uint64, page string, metadata models.Properties) error {
+	properties := models.Properties{
 		"page": page,
 	}
 	if metadata != nil {
@@ -108,11 +161,11 @@ func (p *Publisher) TrackPageView(ctx context.Context, userID uint64, page strin
 }
 
 // API Request Events
-func (p *Publisher) TrackAPIRequest(ctx context.Context, userID uint64, endpoint, method string, statusCode int, metadata map[string]string) error {
-	properties := map[string]string{
+func (p *Publisher) TrackAPIRequest(ctx context.Context, userID uint64, endpoint, method string, statusCode int, metadata models.Properties) error {
+	properties := models.Properties{
 		"endpoint":    endpoint,
 		"method":      method,
-		"status_code": strconv.Itoa(statusCode),
+		"status_code": statusCode,
 	}
 	if metadata != nil {
 		for k, v := range metadata {
@@ -142,8 +195,8 @@ func (p *Publisher) LogUserAction(ctx context.Context, userID uint64, action, re
 }
 
 // Error Events
-func (p *Publisher) TrackError(ctx context.Context, userID uint64, errorType, message string, metadata map[string]string) error {
-	properties := map[string]string{
+func (p *Publisher) TrackError(ctx context.Context, userID uint64, errorType, message string, metadata models.Properties) error {
+	properties := models.Properties{
 		"error_type": errorType,
 		"message":    message,
 	}
@@ -0,0 +1,142 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/queue"
+)
+
+// Stream event types, named after the routing key they were published with.
+const (
+	StreamAnalytics = RoutingKeyAnalytics
+	StreamAudit     = RoutingKeyAudit
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 256
+
+// StreamEvent is an analytics event or audit log as delivered to live
+// subscribers. Name is the analytics event name or the audit action.
+type StreamEvent struct {
+	Type     string          `json:"type"`
+	OrgID    uint64          `json:"-"`
+	UserID   uint64          `json:"-"`
+	Name     string          `json:"-"`
+	Resource string          `json:"-"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// StreamFilter selects the events a subscriber receives. OrgID is required;
+// empty fields match anything.
+type StreamFilter struct {
+	OrgID     uint64
+	Types     map[string]bool
+	Names     map[string]bool
+	UserID    uint64
+	Resources map[string]bool
+}
+
+func (f StreamFilter) matches(e StreamEvent) bool {
+	if e.OrgID != f.OrgID {
+		return false
+	}
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	if len(f.Names) > 0 && !f.Names[e.Name] {
+		return false
+	}
+	if f.UserID != 0 && e.UserID != f.UserID {
+		return false
+	}
+	if len(f.Resources) > 0 && !f.Resources[e.Resource] {
+		return false
+	}
+	return true
+}
+
+// Subscription receives matching events on C until it is unsubscribed.
+type Subscription struct {
+	C      <-chan StreamEvent
+	c      chan StreamEvent
+	filter StreamFilter
+}
+
+// Hub fans events from a queue subscription out to live subscribers. Filtering
+// happens here so clients only receive events of their own organization.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Run dispatches msgs to subscribers until msgs is closed.
+func (h *Hub) Run(msgs <-chan queue.Message) {
+	for msg := range msgs {
+		event, err := decodeStreamEvent(msg)
+		if err != nil {
+			log.Printf("Error decoding stream event: %v", err)
+			continue
+		}
+		h.dispatch(event)
+	}
+	log.Printf("Live event subscription closed")
+}
+
+func (h *Hub) dispatch(event StreamEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			// Never block the hub on a slow client
+		}
+	}
+}
+
+// Subscribe registers a subscriber. Callers must Unsubscribe when done.
+func (h *Hub) Subscribe(filter StreamFilter) *Subscription {
+	c := make(chan StreamEvent, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, filter: filter}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+func decodeStreamEvent(msg queue.Message) (StreamEvent, error) {
+	event := StreamEvent{Type: msg.RoutingKey, Data: msg.Body}
+	switch msg.RoutingKey {
+	case RoutingKeyAnalytics:
+		var e models.AnalyticsEvent
+		if err := json.Unmarshal(msg.Body, &e); err != nil {
+			return StreamEvent{}, err
+		}
+		event.OrgID, event.UserID, event.Name = e.OrgID, e.UserID, e.Event
+	case RoutingKeyAudit:
+		var l models.AuditLog
+		if err := json.Unmarshal(msg.Body, &l); err != nil {
+			return StreamEvent{}, err
+		}
+		event.OrgID, event.UserID, event.Name, event.Resource = l.OrgID, l.UserID, l.Action, l.Resource
+	}
+	return event, nil
+}
@@ -0,0 +1,145 @@
+package eventschema
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// cacheTTL is how long an organization's schemas are cached, and so how long
+// schema and mode changes take to reach ingest.
+const cacheTTL = 30 * time.Second
+
+// maxCachedOrgs bounds the cache. Organizations come from API keys and
+// backend events, so the cache only grows with the number of organizations
+// sending events; the least recently used are evicted beyond this.
+const maxCachedOrgs = 10000
+
+// Result is the outcome of checking one event. Errors is empty for valid
+// events; Mode says what to do with invalid ones.
+type Result struct {
+	Mode   string
+	Errors []string
+}
+
+func (r Result) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+type orgSchemas struct {
+	orgID    uint64
+	mode     string
+	schemas  map[string]*models.EventSchema
+	loadedAt time.Time
+}
+
+// Registry checks events against their organization's schemas.
+type Registry struct {
+	db *database.Database
+
+	mu   sync.Mutex
+	orgs map[uint64]*list.Element // of *orgSchemas, most recently used first
+	lru  *list.List
+}
+
+func NewRegistry(db *database.Database) *Registry {
+	return &Registry{db: db, orgs: make(map[uint64]*list.Element), lru: list.New()}
+}
+
+// Check validates event when its organization has validation enabled. Event
+// names must be registered unless they are built in.
+func (r *Registry) Check(ctx context.Context, event models.AnalyticsEvent) (Result, error) {
+	org, err := r.load(ctx, event.OrgID)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Mode: org.mode}
+	if org.mode == models.EventValidationOff {
+		return result, nil
+	}
+
+	schema, ok := org.schemas[event.Event]
+	switch {
+	case ok:
+		result.Errors = Validate(schema, event.Properties)
+	case !models.IsBuiltinEvent(event.Event):
+		result.Errors = []string{fmt.Sprintf("event %q is not registered", event.Event)}
+	}
+	return result, nil
+}
+
+func (r *Registry) load(ctx context.Context, orgID uint64) (*orgSchemas, error) {
+	if org := r.cached(orgID); org != nil {
+		return org, nil
+	}
+
+	mode, err := models.GetEventValidationMode(ctx, r.db.Pool, uint(orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Organizations that do not exist have not opted in either. Cache
+		// that too so unknown IDs do not reach Postgres on every event.
+		org := &orgSchemas{orgID: orgID, mode: models.EventValidationOff, loadedAt: time.Now()}
+		r.store(org)
+		return org, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading event validation mode: %w", err)
+	}
+
+	schemas, err := models.GetEventSchemas(ctx, r.db.Pool, uint(orgID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading event schemas: %w", err)
+	}
+	org := &orgSchemas{orgID: orgID, mode: mode, schemas: make(map[string]*models.EventSchema, len(schemas)), loadedAt: time.Now()}
+	for i := range schemas {
+		org.schemas[schemas[i].EventName] = &schemas[i]
+	}
+	r.store(org)
+	return org, nil
+}
+
+// cached returns the organization's schemas if they were loaded within
+// cacheTTL.
+func (r *Registry) cached(orgID uint64) *orgSchemas {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.orgs[orgID]
+	if e == nil {
+		return nil
+	}
+	org := e.Value.(*orgSchemas)
+	if time.Since(org.loadedAt) >= cacheTTL {
+		r.lru.Remove(e)
+		delete(r.orgs, orgID)
+		return nil
+	}
+	r.lru.MoveToFront(e)
+	return org
+}
+
+// store caches org, evicting the least recently used organizations beyond
+// maxCachedOrgs.
+func (r *Registry) store(org *orgSchemas) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e := r.orgs[org.orgID]; e != nil {
+		e.Value = org
+		r.lru.MoveToFront(e)
+		return
+	}
+	r.orgs[org.orgID] = r.lru.PushFront(org)
+	for r.lru.Len() > maxCachedOrgs {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.orgs, oldest.Value.(*orgSchemas).orgID)
+	}
+}
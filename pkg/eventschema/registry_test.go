@@ -0,0 +1,43 @@
+package eventschema
+
+import (
+	"testing"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+func TestRegistryCacheIsBounded(t *testing.T) {
+	r := NewRegistry(nil)
+	for id := uint64(1); id <= maxCachedOrgs+10; id++ {
+		r.store(&orgSchemas{orgID: id, mode: models.EventValidationOff, loadedAt: time.Now()})
+		if id == maxCachedOrgs {
+			// Keep org 1 recently used so it survives eviction
+			r.cached(1)
+		}
+	}
+
+	if got := len(r.orgs); got != maxCachedOrgs {
+		t.Fatalf("cached %d organizations, want %d", got, maxCachedOrgs)
+	}
+	if r.cached(1) == nil {
+		t.Error("recently used organization was evicted")
+	}
+	if r.cached(2) != nil {
+		t.Error("least recently used organization was not evicted")
+	}
+	if r.cached(maxCachedOrgs+10) == nil {
+		t.Error("newest organization was evicted")
+	}
+}
+
+func TestRegistryCacheExpires(t *testing.T) {
+	r := NewRegistry(nil)
+	r.store(&orgSchemas{orgID: 1, mode: models.EventValidationOff, loadedAt: time.Now().Add(-cacheTTL)})
+	if r.cached(1) != nil {
+		t.Fatal("expired entry was returned")
+	}
+	if len(r.orgs) != 0 || r.lru.Len() != 0 {
+		t.Fatal("expired entry was not removed")
+	}
+}
@@ -0,0 +1,135 @@
+package eventschema
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+// MaxEventNameLength caps registered event names.
+const MaxEventNameLength = 128
+
+// CheckSchema reports whether a schema definition is usable: every property
+// has a known type and every enum value is of that type. Arrays take no enum.
+func CheckSchema(schema *models.EventSchema) error {
+	if schema.EventName == "" || len(schema.EventName) > MaxEventNameLength {
+		return fmt.Errorf("event_name must be 1 to %d characters", MaxEventNameLength)
+	}
+	for name, prop := range schema.Properties {
+		if name == "" {
+			return errors.New("property names must not be empty")
+		}
+		if !isValidType(prop.Type) {
+			return fmt.Errorf("property %q: unknown type %q", name, prop.Type)
+		}
+		if prop.Type == models.PropertyTypeArray && len(prop.Enum) > 0 {
+			return fmt.Errorf("property %q: arrays cannot have an enum", name)
+		}
+		for _, v := range prop.Enum {
+			if !validEnumValue(prop.Type, v) {
+				return fmt.Errorf("property %q: enum value %q is not of type %s", name, v, prop.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func isValidType(t string) bool {
+	switch t {
+	case models.PropertyTypeString, models.PropertyTypeNumber, models.PropertyTypeInteger,
+		models.PropertyTypeBoolean, models.PropertyTypeTimestamp, models.PropertyTypeArray:
+		return true
+	}
+	return false
+}
+
+// validEnumValue reports whether an enum value, given as a string, parses as
+// type t.
+func validEnumValue(t, value string) bool {
+	var err error
+	switch t {
+	case models.PropertyTypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case models.PropertyTypeInteger:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case models.PropertyTypeBoolean:
+		_, err = strconv.ParseBool(value)
+	case models.PropertyTypeTimestamp:
+		_, err = time.Parse(time.RFC3339, value)
+	}
+	return err == nil
+}
+
+// hasType reports whether v is a property value of type t.
+func hasType(t string, v interface{}) bool {
+	switch t {
+	case models.PropertyTypeInteger:
+		n, ok := models.PropertyNumber(v)
+		return ok && n == math.Trunc(n)
+	case models.PropertyTypeTimestamp:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	}
+	return models.PropertyType(v) == t
+}
+
+// Validate returns every way properties violate schema, in property order.
+// Enum values are compared with the string form of the property.
+func Validate(schema *models.EventSchema, properties models.Properties) []string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		prop := schema.Properties[name]
+		value, ok := properties[name]
+		if !ok {
+			if prop.Required {
+				problems = append(problems, fmt.Sprintf("property %q is required", name))
+			}
+			continue
+		}
+		if !hasType(prop.Type, value) {
+			problems = append(problems, fmt.Sprintf("property %q must be of type %s", name, prop.Type))
+			continue
+		}
+		if len(prop.Enum) > 0 && !contains(prop.Enum, models.FormatProperty(value)) {
+			problems = append(problems, fmt.Sprintf("property %q must be one of %v", name, prop.Enum))
+		}
+	}
+
+	if !schema.AllowAdditionalProperties {
+		var extra []string
+		for name := range properties {
+			if _, ok := schema.Properties[name]; !ok {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			problems = append(problems, fmt.Sprintf("property %q is not in the schema", name))
+		}
+	}
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package eventschema
+
+import (
+	"reflect"
+	"testing"
+
+	"go-turbo/pkg/models"
+)
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]models.PropertySchema
+		wantErr    bool
+	}{
+		{"valid", map[string]models.PropertySchema{
+			"plan":  {Type: models.PropertyTypeString, Required: true, Enum: []string{"free", "pro"}},
+			"seats": {Type: models.PropertyTypeInteger, Enum: []string{"1", "5"}},
+			"at":    {Type: models.PropertyTypeTimestamp},
+			"tags":  {Type: models.PropertyTypeArray},
+		}, false},
+		{"empty property name", map[string]models.PropertySchema{"": {Type: models.PropertyTypeString}}, true},
+		{"unknown type", map[string]models.PropertySchema{"plan": {Type: "object"}}, true},
+		{"array enum", map[string]models.PropertySchema{"tags": {Type: models.PropertyTypeArray, Enum: []string{"a"}}}, true},
+		{"integer enum not an integer", map[string]models.PropertySchema{"seats": {Type: models.PropertyTypeInteger, Enum: []string{"1.5"}}}, true},
+		{"number enum not a number", map[string]models.PropertySchema{"price": {Type: models.PropertyTypeNumber, Enum: []string{"cheap"}}}, true},
+		{"boolean enum not a boolean", map[string]models.PropertySchema{"paid": {Type: models.PropertyTypeBoolean, Enum: []string{"yes"}}}, true},
+		{"timestamp enum not RFC 3339", map[string]models.PropertySchema{"at": {Type: models.PropertyTypeTimestamp, Enum: []string{"2024-01-01"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSchema(&models.EventSchema{EventName: "signup", Properties: tt.properties})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaEventName(t *testing.T) {
+	for _, name := range []string{"", string(make([]byte, MaxEventNameLength+1))} {
+		if err := CheckSchema(&models.EventSchema{EventName: name}); err == nil {
+			t.Errorf("CheckSchema() accepted an event name of %d characters", len(name))
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := &models.EventSchema{
+		EventName: "signup",
+		Properties: map[string]models.PropertySchema{
+			"plan":  {Type: models.PropertyTypeString, Required: true, Enum: []string{"free", "pro"}},
+			"seats": {Type: models.PropertyTypeInteger, Enum: []string{"1", "5"}},
+			"at":    {Type: models.PropertyTypeTimestamp},
+			"price": {Type: models.PropertyTypeNumber},
+		},
+	}
+	tests := []struct {
+		name       string
+		properties models.Properties
+		additional bool
+		want       []string
+	}{
+		{"valid", models.Properties{"plan": "pro", "seats": float64(5), "at": "2024-01-01T00:00:00Z", "price": 9.5}, false, nil},
+		{"missing required", models.Properties{"seats": float64(1)}, false,
+			[]string{`property "plan" is required`}},
+		{"wrong type", models.Properties{"plan": true}, false,
+			[]string{`property "plan" must be of type string`}},
+		{"fractional integer", models.Properties{"plan": "pro", "seats": 1.5}, false,
+			[]string{`property "seats" must be of type integer`}},
+		{"whole number as integer", models.Properties{"plan": "pro", "seats": float64(1)}, false, nil},
+		{"timestamp not RFC 3339", models.Properties{"plan": "pro", "at": "2024-01-01"}, false,
+			[]string{`property "at" must be of type timestamp`}},
+		{"timestamp not a string", models.Properties{"plan": "pro", "at": float64(1704067200)}, false,
+			[]string{`property "at" must be of type timestamp`}},
+		{"not in enum", models.Properties{"plan": "team", "seats": float64(2)}, false,
+			[]string{`property "plan" must be one of [free pro]`, `property "seats" must be one of [1 5]`}},
+		{"additional property", models.Properties{"plan": "pro", "source": "ad", "campaign": "x"}, false,
+			[]string{`property "campaign" is not in the schema`, `property "source" is not in the schema`}},
+		{"additional property allowed", models.Properties{"plan": "pro", "source": "ad"}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *schema
+			s.AllowAdditionalProperties = tt.additional
+			if got := Validate(&s, tt.properties); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RecordAlert stores that rule fired for groupKey and reports whether
+// subscribers should be notified. A rule and group that already fired within
+// cooldown is only counted as suppressed.
+func RecordAlert(ctx context.Context, pool *pgxpool.Pool, rule, groupKey string, orgID uint64, severity string, eventCount int, cooldown time.Duration) (bool, error) {
+	var notify bool
+	// now() is fixed for the statement, so fired_at equals last_seen_at
+	// exactly when this firing was not suppressed.
+	err := pool.QueryRow(ctx,
+		`INSERT INTO alert_states (rule, group_key, org_id, severity, event_count, fired_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, now(), now())
+		ON CONFLICT (rule, group_key) DO UPDATE SET
+			severity = EXCLUDED.severity,
+			event_count = EXCLUDED.event_count,
+			last_seen_at = now(),
+			fire_count = alert_states.fire_count + CASE WHEN alert_states.fired_at <= now() - make_interval(secs => $6) THEN 1 ELSE 0 END,
+			suppressed_count = alert_states.suppressed_count + CASE WHEN alert_states.fired_at <= now() - make_interval(secs => $6) THEN 0 ELSE 1 END,
+			fired_at = CASE WHEN alert_states.fired_at <= now() - make_interval(secs => $6) THEN now() ELSE alert_states.fired_at END
+		RETURNING fired_at = last_seen_at`,
+		rule, groupKey, int64(orgID), severity, eventCount, cooldown.Seconds()).Scan(&notify)
+	return notify, err
+}
@@ -6,12 +6,13 @@ import (
 )
 
 type AnalyticsEvent struct {
-	ID         string            `json:"id,omitempty"`
-	Timestamp  time.Time         `json:"timestamp"`
-	UserID     uint64            `json:"user_id"`
-	Event      string            `json:"event"`
-	Metadata   string            `json:"metadata,omitempty"`
-	Properties map[string]string `json:"properties,omitempty"`
+	ID         string     `json:"id,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+	OrgID      uint64     `json:"org_id"`
+	UserID     uint64     `json:"user_id"`
+	Event      string     `json:"event"`
+	Metadata   string     `json:"metadata,omitempty"`
+	Properties Properties `json:"properties,omitempty"`
 }
 
 // Common analytics events
@@ -26,6 +27,17 @@ const (
 	EventErrorOccured = "error_occurred"
 )
 
+// IsBuiltinEvent reports whether name is one of the common events above,
+// which pass event validation without a registered schema.
+func IsBuiltinEvent(name string) bool {
+	switch name {
+	case EventPageView, EventButtonClick, EventFormSubmit, EventAPIRequest,
+		EventUserSignup, EventUserLogin, EventUserLogout, EventErrorOccured:
+		return true
+	}
+	return false
+}
+
 // Helper method to set metadata as JSON
 func (e *AnalyticsEvent) SetMetadata(data interface{}) error {
 	if data == nil {
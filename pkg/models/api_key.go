@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKey struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"user_id"`
+	OrgID      uint       `json:"org_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+var ErrAPIKeyInvalid = errors.New("api key is invalid, expired or revoked")
+
+// apiKeyUsageInterval limits how often last-used tracking writes for one key
+const apiKeyUsageInterval = time.Minute
+
+func CreateAPIKey(ctx context.Context, pool *pgxpool.Pool, key *APIKey, keyHash string) error {
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		key.UserID, key.OrgID, key.Name, key.Prefix, keyHash, key.Scopes, key.ExpiresAt, now).Scan(&key.ID)
+	if err != nil {
+		return err
+	}
+	key.CreatedAt = now
+	return nil
+}
+
+// GetActiveAPIKeyByHash returns an unrevoked, unexpired key.
+func GetActiveAPIKeyByHash(ctx context.Context, pool *pgxpool.Pool, keyHash string) (*APIKey, error) {
+	var key APIKey
+	var lastUsedIP *string
+	err := pool.QueryRow(ctx,
+		`SELECT id, user_id, organization_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)`,
+		keyHash, time.Now()).Scan(&key.ID, &key.UserID, &key.OrgID, &key.Name, &key.Prefix, &key.Scopes,
+		&key.ExpiresAt, &key.LastUsedAt, &lastUsedIP, &key.RevokedAt, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedIP != nil {
+		key.LastUsedIP = *lastUsedIP
+	}
+	return &key, nil
+}
+
+func GetUserAPIKeys(ctx context.Context, pool *pgxpool.Pool, userID uint) ([]APIKey, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT id, user_id, organization_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		var lastUsedIP *string
+		if err := rows.Scan(&key.ID, &key.UserID, &key.OrgID, &key.Name, &key.Prefix, &key.Scopes,
+			&key.ExpiresAt, &key.LastUsedAt, &lastUsedIP, &key.RevokedAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedIP != nil {
+			key.LastUsedIP = *lastUsedIP
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func RevokeAPIKey(ctx context.Context, pool *pgxpool.Pool, userID, keyID uint) error {
+	tag, err := pool.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL",
+		time.Now(), keyID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIKey records usage at most once per apiKeyUsageInterval and reports
+// whether it wrote, so callers can emit usage events at the same rate.
+func TouchAPIKey(ctx context.Context, pool *pgxpool.Pool, keyID uint, ip string) (bool, error) {
+	now := time.Now()
+	tag, err := pool.Exec(ctx,
+		`UPDATE api_keys SET last_used_at = $1, last_used_ip = $2
+		WHERE id = $3 AND (last_used_at IS NULL OR last_used_at < $4)`,
+		now, ip, keyID, now.Add(-apiKeyUsageInterval))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -5,6 +5,7 @@ import "time"
 type AuditLog struct {
 	ID         string    `json:"id,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
+	OrgID      uint64    `json:"org_id"`
 	UserID     uint64    `json:"user_id"`
 	Action     string    `json:"action"`
 	Resource   string    `json:"resource"`
@@ -22,6 +23,37 @@ const (
 	ActionDelete = "delete"
 	ActionLogin  = "login"
 	ActionLogout = "logout"
+
+	ActionSendVerification     = "send_verification"
+	ActionVerifyEmail          = "verify_email"
+	ActionRequestPasswordReset = "request_password_reset"
+	ActionResetPassword        = "reset_password"
+
+	ActionLockout = "lockout"
+	ActionUnlock  = "unlock"
+
+	ActionEnableTwoFactor         = "enable_two_factor"
+	ActionDisableTwoFactor        = "disable_two_factor"
+	ActionRegenerateRecoveryCodes = "regenerate_recovery_codes"
+	ActionUseRecoveryCode         = "use_recovery_code"
+
+	ActionLinkIdentity = "link_identity"
+
+	ActionUse    = "use"
+	ActionRevoke = "revoke"
+
+	ActionRequestEmailChange = "request_email_change"
+	ActionChangeEmail        = "change_email"
+	ActionChangePassword     = "change_password"
+
+	ActionExport = "export"
+	ActionErase  = "erase"
+
+	ActionTest = "test"
+
+	ActionInvite            = "invite"
+	ActionAcceptInvitation  = "accept_invitation"
+	ActionDeclineInvitation = "decline_invitation"
 )
 
 // Common resources
@@ -30,4 +62,12 @@ const (
 	ResourceProfile = "profile"
 	ResourcePost    = "post"
 	ResourceComment = "comment"
+	ResourceRole    = "role"
+	ResourceOrg     = "organization"
+
+	ResourceIPAddress   = "ip_address"
+	ResourceAPIKey      = "api_key"
+	ResourceSession     = "session"
+	ResourceWebhook     = "webhook"
+	ResourceEventSchema = "event_schema"
 )
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DataRequest tracks a GDPR export or erasure job for a user. OrgID is set
+// for erasures limited to one organization.
+type DataRequest struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"user_id"`
+	OrgID       *uint      `json:"organization_id,omitempty"`
+	RequestedBy uint       `json:"requested_by"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	FilePath    string     `json:"-"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Data request kinds
+const (
+	DataRequestExport     = "export"
+	DataRequestErasure    = "erasure"
+	DataRequestOrgErasure = "org_erasure"
+)
+
+// Data request statuses
+const (
+	DataRequestPending   = "pending"
+	DataRequestRunning   = "running"
+	DataRequestCompleted = "completed"
+	DataRequestFailed    = "failed"
+	DataRequestExpired   = "expired"
+)
+
+const dataRequestColumns = `id, user_id, organization_id, requested_by, kind, status, COALESCE(error, ''), COALESCE(file_path, ''), expires_at, created_at, completed_at`
+
+func scanDataRequest(row interface{ Scan(...any) error }, req *DataRequest) error {
+	return row.Scan(&req.ID, &req.UserID, &req.OrgID, &req.RequestedBy, &req.Kind, &req.Status, &req.Error,
+		&req.FilePath, &req.ExpiresAt, &req.CreatedAt, &req.CompletedAt)
+}
+
+func CreateDataRequest(ctx context.Context, pool *pgxpool.Pool, req *DataRequest) error {
+	now := time.Now()
+	req.Status = DataRequestPending
+	err := pool.QueryRow(ctx,
+		`INSERT INTO data_requests (user_id, organization_id, requested_by, kind, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		req.UserID, req.OrgID, req.RequestedBy, req.Kind, req.Status, now).Scan(&req.ID)
+	if err != nil {
+		return err
+	}
+	req.CreatedAt = now
+	return nil
+}
+
+func GetDataRequest(ctx context.Context, pool *pgxpool.Pool, id uint) (*DataRequest, error) {
+	var req DataRequest
+	err := scanDataRequest(pool.QueryRow(ctx,
+		"SELECT "+dataRequestColumns+" FROM data_requests WHERE id = $1",
+		id), &req)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func GetUserDataRequests(ctx context.Context, pool *pgxpool.Pool, userID uint, kind string) ([]DataRequest, error) {
+	rows, err := pool.Query(ctx,
+		"SELECT "+dataRequestColumns+" FROM data_requests WHERE user_id = $1 AND kind = $2 ORDER BY created_at DESC",
+		userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []DataRequest
+	for rows.Next() {
+		var req DataRequest
+		if err := scanDataRequest(rows, &req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+func StartDataRequest(ctx context.Context, pool *pgxpool.Pool, id uint) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE data_requests SET status = $1 WHERE id = $2",
+		DataRequestRunning, id)
+	return err
+}
+
+func CompleteDataRequest(ctx context.Context, pool *pgxpool.Pool, id uint, filePath string, expiresAt *time.Time) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE data_requests SET status = $1, file_path = NULLIF($2, ''), expires_at = $3, completed_at = $4 WHERE id = $5",
+		DataRequestCompleted, filePath, expiresAt, time.Now(), id)
+	return err
+}
+
+func FailDataRequest(ctx context.Context, pool *pgxpool.Pool, id uint, reason string) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE data_requests SET status = $1, error = $2, completed_at = $3 WHERE id = $4",
+		DataRequestFailed, reason, time.Now(), id)
+	return err
+}
+
+// GetExpiredExports returns completed exports whose download window ended
+// before now.
+func GetExpiredExports(ctx context.Context, pool *pgxpool.Pool, now time.Time) ([]DataRequest, error) {
+	rows, err := pool.Query(ctx,
+		"SELECT "+dataRequestColumns+" FROM data_requests WHERE kind = $1 AND status = $2 AND expires_at <= $3",
+		DataRequestExport, DataRequestCompleted, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []DataRequest
+	for rows.Next() {
+		var req DataRequest
+		if err := scanDataRequest(rows, &req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+// ExpireDataRequest marks an export whose file was deleted as expired.
+func ExpireDataRequest(ctx context.Context, pool *pgxpool.Pool, id uint) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE data_requests SET status = $1, file_path = NULL WHERE id = $2",
+		DataRequestExpired, id)
+	return err
+}
+
+// FailInterruptedDataRequests marks jobs left unfinished by a restart as
+// failed so they can be requested again.
+func FailInterruptedDataRequests(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	tag, err := pool.Exec(ctx,
+		"UPDATE data_requests SET status = $1, error = $2, completed_at = $3 WHERE status IN ($4, $5)",
+		DataRequestFailed, "interrupted by restart", time.Now(), DataRequestPending, DataRequestRunning)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
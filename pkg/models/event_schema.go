@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PropertySchema constrains one property of an event. Type is one of the
+// PropertyType constants; Enum, when set, lists the allowed values.
+type PropertySchema struct {
+	Type     string   `json:"type"`
+	Required bool     `json:"required,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// Property types. Integers are whole numbers and timestamps are RFC 3339
+// strings.
+const (
+	PropertyTypeString    = "string"
+	PropertyTypeNumber    = "number"
+	PropertyTypeInteger   = "integer"
+	PropertyTypeBoolean   = "boolean"
+	PropertyTypeTimestamp = "timestamp"
+	PropertyTypeArray     = "array"
+)
+
+// EventSchema registers an event name for an organization and describes its
+// properties.
+type EventSchema struct {
+	ID                        uint                      `json:"id"`
+	OrgID                     uint                      `json:"org_id"`
+	EventName                 string                    `json:"event_name"`
+	Description               string                    `json:"description"`
+	Properties                map[string]PropertySchema `json:"properties"`
+	AllowAdditionalProperties bool                      `json:"allow_additional_properties"`
+	CreatedBy                 *uint                     `json:"created_by,omitempty"`
+	CreatedAt                 time.Time                 `json:"created_at"`
+	UpdatedAt                 time.Time                 `json:"updated_at"`
+}
+
+// Event validation modes of an organization
+const (
+	EventValidationOff        = "off"
+	EventValidationReject     = "reject"
+	EventValidationQuarantine = "quarantine"
+)
+
+func IsValidEventValidationMode(mode string) bool {
+	return mode == EventValidationOff || mode == EventValidationReject || mode == EventValidationQuarantine
+}
+
+// SaveEventSchema creates the schema for its event name or replaces the
+// existing one.
+func SaveEventSchema(ctx context.Context, pool *pgxpool.Pool, schema *EventSchema) error {
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`INSERT INTO event_schemas (organization_id, event_name, description, properties, allow_additional_properties, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (organization_id, event_name) DO UPDATE SET
+			description = EXCLUDED.description,
+			properties = EXCLUDED.properties,
+			allow_additional_properties = EXCLUDED.allow_additional_properties,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_by, created_at`,
+		schema.OrgID, schema.EventName, schema.Description, schema.Properties, schema.AllowAdditionalProperties,
+		schema.CreatedBy, now).Scan(&schema.ID, &schema.CreatedBy, &schema.CreatedAt)
+	if err != nil {
+		return err
+	}
+	schema.UpdatedAt = now
+	return nil
+}
+
+const eventSchemaColumns = `id, organization_id, event_name, description, properties, allow_additional_properties, created_by, created_at, updated_at`
+
+func scanEventSchema(row pgx.Row) (*EventSchema, error) {
+	var schema EventSchema
+	if err := row.Scan(&schema.ID, &schema.OrgID, &schema.EventName, &schema.Description, &schema.Properties,
+		&schema.AllowAdditionalProperties, &schema.CreatedBy, &schema.CreatedAt, &schema.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func GetEventSchema(ctx context.Context, pool *pgxpool.Pool, orgID uint, eventName string) (*EventSchema, error) {
+	return scanEventSchema(pool.QueryRow(ctx,
+		`SELECT `+eventSchemaColumns+` FROM event_schemas WHERE organization_id = $1 AND event_name = $2`,
+		orgID, eventName))
+}
+
+// GetEventSchemas lists the organization's schemas by event name.
+func GetEventSchemas(ctx context.Context, pool *pgxpool.Pool, orgID uint) ([]EventSchema, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+eventSchemaColumns+` FROM event_schemas WHERE organization_id = $1 ORDER BY event_name`,
+		orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := []EventSchema{}
+	for rows.Next() {
+		schema, err := scanEventSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, *schema)
+	}
+	return schemas, rows.Err()
+}
+
+func DeleteEventSchema(ctx context.Context, pool *pgxpool.Pool, orgID uint, eventName string) error {
+	tag, err := pool.Exec(ctx,
+		"DELETE FROM event_schemas WHERE organization_id = $1 AND event_name = $2",
+		orgID, eventName)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func GetEventValidationMode(ctx context.Context, pool *pgxpool.Pool, orgID uint) (string, error) {
+	var mode string
+	err := pool.QueryRow(ctx, "SELECT event_validation FROM organizations WHERE id = $1", orgID).Scan(&mode)
+	return mode, err
+}
+
+func SetEventValidationMode(ctx context.Context, pool *pgxpool.Pool, orgID uint, mode string) error {
+	tag, err := pool.Exec(ctx,
+		"UPDATE organizations SET event_validation = $1, updated_at = $2 WHERE id = $3",
+		mode, time.Now(), orgID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserIdentity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	UserID      uint       `json:"user_id"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type OIDCLoginState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+var ErrOIDCStateInvalid = errors.New("login state is invalid or expired")
+
+// GetUserIDByIdentity returns the user linked to an external identity.
+func GetUserIDByIdentity(ctx context.Context, pool *pgxpool.Pool, provider, subject string) (uint, error) {
+	var userID uint
+	err := pool.QueryRow(ctx,
+		"SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, subject).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func LinkIdentity(ctx context.Context, pool *pgxpool.Pool, identity *UserIdentity) error {
+	now := time.Now()
+	_, err := pool.Exec(ctx,
+		`INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, now)
+	if err != nil {
+		return err
+	}
+	identity.CreatedAt = now
+	return nil
+}
+
+func TouchIdentity(ctx context.Context, pool *pgxpool.Pool, provider, subject string) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE user_identities SET last_login_at = $1 WHERE provider = $2 AND subject = $3",
+		time.Now(), provider, subject)
+	return err
+}
+
+func GetUserIdentities(ctx context.Context, pool *pgxpool.Pool, userID uint) ([]UserIdentity, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT provider, subject, user_id, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1 ORDER BY created_at`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []UserIdentity
+	for rows.Next() {
+		var identity UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func CreateOIDCLoginState(ctx context.Context, pool *pgxpool.Pool, state *OIDCLoginState) error {
+	// Opportunistically clear abandoned logins
+	if _, err := pool.Exec(ctx, "DELETE FROM oidc_login_states WHERE expires_at < $1", time.Now()); err != nil {
+		return err
+	}
+
+	_, err := pool.Exec(ctx,
+		`INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		state.State, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginState deletes and returns a pending login so each state is used once.
+func ConsumeOIDCLoginState(ctx context.Context, pool *pgxpool.Pool, provider, state string) (*OIDCLoginState, error) {
+	var loginState OIDCLoginState
+	err := pool.QueryRow(ctx,
+		`DELETE FROM oidc_login_states
+		WHERE state = $1 AND provider = $2 AND expires_at > $3
+		RETURNING state, provider, nonce, code_verifier, expires_at`,
+		state, provider, time.Now()).Scan(&loginState.State, &loginState.Provider, &loginState.Nonce, &loginState.CodeVerifier, &loginState.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loginState, nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoginThrottle struct {
+	Scope        string     `json:"scope"`
+	Key          string     `json:"key"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+// Throttle scopes
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+)
+
+// GetLoginThrottle returns the failure counter for a key, or nil if none exists.
+func GetLoginThrottle(ctx context.Context, pool *pgxpool.Pool, scope, key string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	err := pool.QueryRow(ctx,
+		"SELECT scope, key, failures, last_failed_at, locked_until FROM login_throttles WHERE scope = $1 AND key = $2",
+		scope, key).Scan(&throttle.Scope, &throttle.Key, &throttle.Failures, &throttle.LastFailedAt, &throttle.LockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// RecordLoginFailure increments the failure counter, resetting it when the
+// previous failure is older than window, and locks the key for lockFor once
+// lockAfter failures are reached. The returned bool reports whether this
+// failure triggered a new lockout.
+func RecordLoginFailure(ctx context.Context, pool *pgxpool.Pool, scope, key string, window time.Duration, lockAfter int, lockFor time.Duration) (*LoginThrottle, bool, error) {
+	now := time.Now()
+	var throttle LoginThrottle
+	err := pool.QueryRow(ctx,
+		`INSERT INTO login_throttles (scope, key, failures, last_failed_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failed_at < $3 - $4 * INTERVAL '1 second'
+					AND (login_throttles.locked_until IS NULL OR login_throttles.locked_until < $3)
+				THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failed_at = $3
+		RETURNING scope, key, failures, last_failed_at, locked_until`,
+		scope, key, now, window.Seconds()).Scan(&throttle.Scope, &throttle.Key, &throttle.Failures, &throttle.LastFailedAt, &throttle.LockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	alreadyLocked := throttle.LockedUntil != nil && throttle.LockedUntil.After(now)
+	if alreadyLocked || throttle.Failures < lockAfter {
+		return &throttle, false, nil
+	}
+
+	lockedUntil := now.Add(lockFor)
+	_, err = pool.Exec(ctx,
+		"UPDATE login_throttles SET locked_until = $1, failures = 0 WHERE scope = $2 AND key = $3",
+		lockedUntil, scope, key)
+	if err != nil {
+		return nil, false, err
+	}
+	throttle.LockedUntil = &lockedUntil
+	return &throttle, true, nil
+}
+
+func ClearLoginThrottle(ctx context.Context, pool *pgxpool.Pool, scope, key string) error {
+	_, err := pool.Exec(ctx, "DELETE FROM login_throttles WHERE scope = $1 AND key = $2", scope, key)
+	return err
+}
@@ -0,0 +1,367 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Organization struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrganizationMember struct {
+	OrganizationID uint      `json:"organization_id"`
+	UserID         uint      `json:"user_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrganizationInvitation is a pending offer for a user to join an
+// organization. The user becomes a member only by accepting it.
+type OrganizationInvitation struct {
+	OrganizationID   uint      `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	UserID           uint      `json:"user_id"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	InvitedBy        *uint     `json:"invited_by,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// Organization membership roles
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// memberRoles maps membership roles to the role whose permissions a member
+// gets in that organization. users.role is global and grants nothing within
+// an organization.
+var memberRoles = map[string]string{
+	OrgRoleOwner:  "admin",
+	OrgRoleMember: "user",
+}
+
+// MemberRole returns the role that defines a member's permissions in their
+// organization.
+func MemberRole(orgRole string) string {
+	if role, ok := memberRoles[orgRole]; ok {
+		return role
+	}
+	return memberRoles[OrgRoleMember]
+}
+
+var ErrNoOrganization = errors.New("user does not belong to any organization")
+
+// CreateOrganization creates the organization and makes ownerID its owner.
+func CreateOrganization(ctx context.Context, pool *pgxpool.Pool, org *Organization, ownerID uint) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	err = tx.QueryRow(ctx,
+		`INSERT INTO organizations (name, created_at, updated_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		org.Name, now, now).Scan(&org.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		org.ID, ownerID, OrgRoleOwner, now)
+	if err != nil {
+		return err
+	}
+
+	org.CreatedAt = now
+	org.UpdatedAt = now
+	return tx.Commit(ctx)
+}
+
+func GetOrganizationByID(ctx context.Context, pool *pgxpool.Pool, id uint) (*Organization, error) {
+	var org Organization
+	err := pool.QueryRow(ctx,
+		"SELECT id, name, created_at, updated_at FROM organizations WHERE id = $1",
+		id).Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetUserOrganizations(ctx context.Context, pool *pgxpool.Pool, userID uint) ([]Organization, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT o.id, o.name, o.created_at, o.updated_at FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, o.id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []Organization
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetDefaultOrganizationID returns the organization the user joined first.
+func GetDefaultOrganizationID(ctx context.Context, pool *pgxpool.Pool, userID uint) (uint, error) {
+	var orgID uint
+	err := pool.QueryRow(ctx,
+		`SELECT organization_id FROM organization_members
+		WHERE user_id = $1
+		ORDER BY created_at, organization_id
+		LIMIT 1`,
+		userID).Scan(&orgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNoOrganization
+	}
+	return orgID, err
+}
+
+func GetMembership(ctx context.Context, pool *pgxpool.Pool, orgID, userID uint) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := pool.QueryRow(ctx,
+		`SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2`,
+		orgID, userID).Scan(&member.OrganizationID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(ctx context.Context, pool *pgxpool.Pool, orgID uint) ([]OrganizationMember, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.created_at`,
+		orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []OrganizationMember
+	for rows.Next() {
+		var member OrganizationMember
+		if err := rows.Scan(&member.OrganizationID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// UpdateOrganizationMemberRole changes the role of an existing member.
+func UpdateOrganizationMemberRole(ctx context.Context, pool *pgxpool.Pool, orgID, userID uint, role string) error {
+	tag, err := pool.Exec(ctx,
+		"UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3",
+		role, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveUserFromOrganization ends the user's membership and pending
+// invitation and revokes their API keys for the organization. The account and
+// its other memberships are untouched. Returns pgx.ErrNoRows when the user is
+// not a member.
+func RemoveUserFromOrganization(ctx context.Context, pool *pgxpool.Pool, orgID, userID uint) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = $1 WHERE organization_id = $2 AND user_id = $3 AND revoked_at IS NULL",
+		time.Now(), orgID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM organization_invitations WHERE organization_id = $1 AND user_id = $2",
+		orgID, userID); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx,
+		"DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2",
+		orgID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetOrganizationUsers lists the users that belong to the organization.
+func GetOrganizationUsers(ctx context.Context, pool *pgxpool.Pool, orgID uint) ([]User, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT u.id, u.email, u.role, u.created_at, u.updated_at FROM users u
+		JOIN organization_members m ON m.user_id = u.id
+		WHERE m.organization_id = $1
+		ORDER BY u.id`,
+		orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateOrganizationInvitation invites the user to the organization, or
+// renews the pending invitation with the new role and expiry.
+func CreateOrganizationInvitation(ctx context.Context, pool *pgxpool.Pool, inv *OrganizationInvitation) error {
+	now := time.Now()
+	_, err := pool.Exec(ctx,
+		`INSERT INTO organization_invitations (organization_id, user_id, role, invited_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET
+			role = EXCLUDED.role,
+			invited_by = EXCLUDED.invited_by,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at`,
+		inv.OrganizationID, inv.UserID, inv.Role, inv.InvitedBy, now, inv.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	inv.CreatedAt = now
+	return nil
+}
+
+const invitationColumns = `i.organization_id, o.name, i.user_id, u.email, i.role, i.invited_by, i.created_at, i.expires_at
+	FROM organization_invitations i
+	JOIN organizations o ON o.id = i.organization_id
+	JOIN users u ON u.id = i.user_id`
+
+func scanInvitations(rows pgx.Rows) ([]OrganizationInvitation, error) {
+	defer rows.Close()
+
+	invitations := []OrganizationInvitation{}
+	for rows.Next() {
+		var inv OrganizationInvitation
+		if err := rows.Scan(&inv.OrganizationID, &inv.OrganizationName, &inv.UserID, &inv.Email, &inv.Role,
+			&inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// GetUserInvitations lists the user's unexpired invitations.
+func GetUserInvitations(ctx context.Context, pool *pgxpool.Pool, userID uint) ([]OrganizationInvitation, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+invitationColumns+`
+		WHERE i.user_id = $1 AND i.expires_at > $2
+		ORDER BY i.created_at`,
+		userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// GetOrganizationInvitations lists the organization's unexpired invitations.
+func GetOrganizationInvitations(ctx context.Context, pool *pgxpool.Pool, orgID uint) ([]OrganizationInvitation, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+invitationColumns+`
+		WHERE i.organization_id = $1 AND i.expires_at > $2
+		ORDER BY i.created_at`,
+		orgID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// AcceptOrganizationInvitation makes the user a member with the invited role
+// and returns that role. It returns pgx.ErrNoRows when there is no unexpired
+// invitation.
+func AcceptOrganizationInvitation(ctx context.Context, pool *pgxpool.Pool, orgID, userID uint) (string, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	var role string
+	err = tx.QueryRow(ctx,
+		`DELETE FROM organization_invitations
+		WHERE organization_id = $1 AND user_id = $2 AND expires_at > $3
+		RETURNING role`,
+		orgID, userID, now).Scan(&role)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization_id, user_id) DO NOTHING`,
+		orgID, userID, role, now)
+	if err != nil {
+		return "", err
+	}
+
+	return role, tx.Commit(ctx)
+}
+
+// DeleteOrganizationInvitation declines or cancels an invitation.
+func DeleteOrganizationInvitation(ctx context.Context, pool *pgxpool.Pool, orgID, userID uint) error {
+	tag, err := pool.Exec(ctx,
+		"DELETE FROM organization_invitations WHERE organization_id = $1 AND user_id = $2",
+		orgID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
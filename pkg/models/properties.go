@@ -0,0 +1,188 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Properties are an analytics event's properties. Values are strings,
+// numbers, bools or arrays of those, which is what decoding JSON produces;
+// Go callers may also use any integer or float type, and []string.
+type Properties map[string]interface{}
+
+// PropertyNumber returns v as a float64 if it is a number.
+func PropertyNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// propertyArray returns the elements of v if it is an array.
+func propertyArray(v interface{}) ([]interface{}, bool) {
+	switch a := v.(type) {
+	case []interface{}:
+		return a, true
+	case []string:
+		elems := make([]interface{}, len(a))
+		for i, s := range a {
+			elems[i] = s
+		}
+		return elems, true
+	}
+	return nil, false
+}
+
+// PropertyType returns the PropertyType constant of v: string, number,
+// boolean or array, or "" for unsupported values. Integers and timestamps
+// are not told apart here; they are numbers and strings.
+func PropertyType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return PropertyTypeString
+	case bool:
+		return PropertyTypeBoolean
+	}
+	if _, ok := PropertyNumber(v); ok {
+		return PropertyTypeNumber
+	}
+	if elems, ok := propertyArray(v); ok {
+		for _, e := range elems {
+			if t := PropertyType(e); t == "" || t == PropertyTypeArray {
+				return ""
+			}
+		}
+		return PropertyTypeArray
+	}
+	return ""
+}
+
+// FormatProperty renders v as a string: numbers in their shortest decimal
+// form, bools as true or false and arrays as JSON.
+func FormatProperty(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	if n, ok := PropertyNumber(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Validate returns an error for the first property whose value is not a
+// string, a finite number, a bool or an array of those.
+func (p Properties) Validate() error {
+	for k, v := range p {
+		if PropertyType(v) == "" {
+			return fmt.Errorf("property %q must be a string, number, boolean or array of those", k)
+		}
+		if n, ok := PropertyNumber(v); ok && (math.IsNaN(n) || math.IsInf(n, 0)) {
+			return fmt.Errorf("property %q must be a finite number", k)
+		}
+	}
+	return nil
+}
+
+// Strings returns every property in string form, as stored in the
+// properties column.
+func (p Properties) Strings() map[string]string {
+	m := make(map[string]string, len(p))
+	for k, v := range p {
+		m[k] = FormatProperty(v)
+	}
+	return m
+}
+
+// Numbers returns the numeric properties.
+func (p Properties) Numbers() map[string]float64 {
+	m := map[string]float64{}
+	for k, v := range p {
+		if n, ok := PropertyNumber(v); ok {
+			m[k] = n
+		}
+	}
+	return m
+}
+
+// Bools returns the boolean properties.
+func (p Properties) Bools() map[string]bool {
+	m := map[string]bool{}
+	for k, v := range p {
+		if b, ok := v.(bool); ok {
+			m[k] = b
+		}
+	}
+	return m
+}
+
+// Arrays returns the array properties with their elements in string form.
+func (p Properties) Arrays() map[string][]string {
+	m := map[string][]string{}
+	for k, v := range p {
+		if elems, ok := propertyArray(v); ok {
+			strs := make([]string, len(elems))
+			for i, e := range elems {
+				strs[i] = FormatProperty(e)
+			}
+			m[k] = strs
+		}
+	}
+	return m
+}
+
+// PropertiesFromColumns rebuilds typed properties from the string form of
+// every property and the typed copies of numbers, bools and arrays.
+func PropertiesFromColumns(strs map[string]string, numbers map[string]float64, bools map[string]bool, arrays map[string][]string) Properties {
+	p := make(Properties, len(strs))
+	for k, v := range strs {
+		p[k] = v
+	}
+	for k, v := range numbers {
+		p[k] = v
+	}
+	for k, v := range bools {
+		p[k] = v
+	}
+	for k, v := range arrays {
+		elems := make([]interface{}, len(v))
+		for i, e := range v {
+			elems[i] = e
+		}
+		p[k] = elems
+	}
+	return p
+}
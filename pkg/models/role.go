@@ -0,0 +1,236 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Role struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	Require2FA  bool      `json:"require_2fa"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Permission struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Built-in permissions
+const (
+	PermissionUsersRead      = "users:read"
+	PermissionUsersWrite     = "users:write"
+	PermissionRolesRead      = "roles:read"
+	PermissionAnalyticsRead  = "analytics:read"
+	PermissionAuditRead      = "audit:read"
+	PermissionWebhooksManage = "webhooks:manage"
+	PermissionSchemasManage  = "schemas:manage"
+	PermissionEventsWrite    = "events:write"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrRoleInUse         = errors.New("role is assigned to users")
+)
+
+// GetRolePermissions returns the permission names granted to the named role.
+func GetRolePermissions(ctx context.Context, pool *pgxpool.Pool, role string) ([]string, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT p.name FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN roles r ON r.id = rp.role_id
+		WHERE r.name = $1
+		ORDER BY p.name`,
+		role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	return permissions, rows.Err()
+}
+
+func GetRoleByName(ctx context.Context, pool *pgxpool.Pool, name string) (*Role, error) {
+	var role Role
+	err := pool.QueryRow(ctx,
+		"SELECT id, name, description, require_2fa, created_at, updated_at FROM roles WHERE name = $1",
+		name).Scan(&role.ID, &role.Name, &role.Description, &role.Require2FA, &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Permissions, err = GetRolePermissions(ctx, pool, role.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func GetAllRoles(ctx context.Context, pool *pgxpool.Pool) ([]Role, error) {
+	rows, err := pool.Query(ctx,
+		"SELECT id, name, description, require_2fa, created_at, updated_at FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Require2FA, &role.CreatedAt, &role.UpdatedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		roles[i].Permissions, err = GetRolePermissions(ctx, pool, roles[i].Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return roles, nil
+}
+
+func GetAllPermissions(ctx context.Context, pool *pgxpool.Pool) ([]Permission, error) {
+	rows, err := pool.Query(ctx,
+		"SELECT id, name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []Permission
+	for rows.Next() {
+		var permission Permission
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func CreateRole(ctx context.Context, pool *pgxpool.Pool, role *Role) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	err = tx.QueryRow(ctx,
+		`INSERT INTO roles (name, description, require_2fa, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		role.Name, role.Description, role.Require2FA, now, now).Scan(&role.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := setRolePermissions(ctx, tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+
+	role.CreatedAt = now
+	role.UpdatedAt = now
+	return tx.Commit(ctx)
+}
+
+// UpdateRole replaces the description, 2FA requirement and permission set of an existing role.
+func UpdateRole(ctx context.Context, pool *pgxpool.Pool, role *Role) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	err = tx.QueryRow(ctx,
+		`UPDATE roles SET description = $1, require_2fa = $2, updated_at = $3
+		WHERE name = $4
+		RETURNING id, created_at`,
+		role.Description, role.Require2FA, now, role.Name).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM role_permissions WHERE role_id = $1", role.ID); err != nil {
+		return err
+	}
+	if err := setRolePermissions(ctx, tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+
+	role.UpdatedAt = now
+	return tx.Commit(ctx)
+}
+
+func DeleteRole(ctx context.Context, pool *pgxpool.Pool, name string) error {
+	// Organization members get their permissions from these roles
+	for _, role := range memberRoles {
+		if role == name {
+			return ErrRoleInUse
+		}
+	}
+
+	var inUse bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)", name).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+
+	tag, err := pool.Exec(ctx, "DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func setRolePermissions(ctx context.Context, tx pgx.Tx, roleID uint, permissions []string) error {
+	for _, name := range permissions {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, id FROM permissions WHERE name = $2
+			ON CONFLICT DO NOTHING`,
+			roleID, name)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var exists bool
+			if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM permissions WHERE name = $1)", name).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return ErrUnknownPermission
+			}
+		}
+	}
+	return nil
+}
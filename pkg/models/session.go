@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Session is a signed-in device. Every JWT carries its session ID, so
+// revoking the session invalidates the token.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     uint       `json:"user_id"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Current    bool       `json:"current"`
+}
+
+var ErrSessionInvalid = errors.New("session is invalid, expired or revoked")
+
+// parseSessionID checks id is a UUID, so queries can compare it with the
+// primary key directly and use its index. Malformed IDs match no session.
+func parseSessionID(id string) (string, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrSessionInvalid
+	}
+	return parsed.String(), nil
+}
+
+// sessionSeenInterval limits how often last-seen tracking writes for one session
+const sessionSeenInterval = time.Minute
+
+func CreateSession(ctx context.Context, pool *pgxpool.Pool, session *Session) error {
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`INSERT INTO sessions (user_id, ip_address, user_agent, expires_at, last_seen_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id`,
+		session.UserID, session.IPAddress, session.UserAgent, session.ExpiresAt, now).Scan(&session.ID)
+	if err != nil {
+		return err
+	}
+	session.LastSeenAt = &now
+	session.CreatedAt = now
+	return nil
+}
+
+// GetActiveSession returns an unrevoked, unexpired session.
+func GetActiveSession(ctx context.Context, pool *pgxpool.Pool, id string) (*Session, error) {
+	id, err := parseSessionID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = pool.QueryRow(ctx,
+		`SELECT id, user_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), expires_at, last_seen_at, created_at
+		FROM sessions
+		WHERE id = $1::uuid AND revoked_at IS NULL AND expires_at > $2`,
+		id, time.Now()).Scan(&session.ID, &session.UserID, &session.IPAddress, &session.UserAgent,
+		&session.ExpiresAt, &session.LastSeenAt, &session.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetUserSessions returns the user's active sessions, most recently seen first.
+func GetUserSessions(ctx context.Context, pool *pgxpool.Pool, userID uint) ([]Session, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT id, user_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), expires_at, last_seen_at, created_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC NULLS LAST`,
+		userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.IPAddress, &session.UserAgent,
+			&session.ExpiresAt, &session.LastSeenAt, &session.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ExtendSession moves the expiry forward when a new token is issued for the session.
+func ExtendSession(ctx context.Context, pool *pgxpool.Pool, id string, expiresAt time.Time) error {
+	id, err := parseSessionID(id)
+	if err != nil {
+		return err
+	}
+
+	tag, err := pool.Exec(ctx,
+		"UPDATE sessions SET expires_at = $1 WHERE id = $2::uuid AND revoked_at IS NULL",
+		expiresAt, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+// TouchSession records activity at most once per sessionSeenInterval.
+func TouchSession(ctx context.Context, pool *pgxpool.Pool, id string) error {
+	id, err := parseSessionID(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = pool.Exec(ctx,
+		`UPDATE sessions SET last_seen_at = $1
+		WHERE id = $2::uuid AND (last_seen_at IS NULL OR last_seen_at < $3)`,
+		now, id, now.Add(-sessionSeenInterval))
+	return err
+}
+
+func RevokeSession(ctx context.Context, pool *pgxpool.Pool, userID uint, id string) error {
+	id, err := parseSessionID(id)
+	if err != nil {
+		return pgx.ErrNoRows
+	}
+
+	tag, err := pool.Exec(ctx,
+		"UPDATE sessions SET revoked_at = $1 WHERE id = $2::uuid AND user_id = $3 AND revoked_at IS NULL",
+		time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of the user except exceptID
+// (pass "" to revoke all) and returns how many were revoked.
+func RevokeUserSessions(ctx context.Context, pool *pgxpool.Pool, userID uint, exceptID string) (int64, error) {
+	var except *string
+	if exceptID != "" {
+		id, err := parseSessionID(exceptID)
+		if err != nil {
+			return 0, err
+		}
+		except = &id
+	}
+
+	tag, err := pool.Exec(ctx,
+		"UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id IS DISTINCT FROM $3::uuid AND revoked_at IS NULL",
+		time.Now(), userID, except)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteStaleSessions removes sessions that expired or were revoked before
+// cutoff and returns how many were removed. Tokens for them are already
+// rejected, so the rows only serve as recent history.
+func DeleteStaleSessions(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx,
+		"DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1",
+		cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
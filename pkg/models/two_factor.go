@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TOTPState struct {
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  *int64
+}
+
+var (
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeReused      = errors.New("code has already been used")
+	ErrRecoveryCodeInvalid = errors.New("invalid recovery code")
+)
+
+func GetTOTPState(ctx context.Context, pool *pgxpool.Pool, userID uint) (*TOTPState, error) {
+	var state TOTPState
+	var secret *string
+	err := pool.QueryRow(ctx,
+		"SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = $1",
+		userID).Scan(&secret, &state.EnabledAt, &state.LastStep)
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil {
+		state.Secret = *secret
+	}
+	return &state, nil
+}
+
+// SetPendingTOTPSecret stores a secret awaiting confirmation. It fails if 2FA
+// is already enabled so an attacker with a session cannot silently re-key it.
+func SetPendingTOTPSecret(ctx context.Context, pool *pgxpool.Pool, userID uint, secret string) error {
+	tag, err := pool.Exec(ctx,
+		`UPDATE users SET totp_secret = $1, totp_last_step = NULL, updated_at = $2
+		WHERE id = $3 AND totp_enabled_at IS NULL`,
+		secret, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func EnableTOTP(ctx context.Context, pool *pgxpool.Pool, userID uint, step int64) error {
+	now := time.Now()
+	tag, err := pool.Exec(ctx,
+		`UPDATE users SET totp_enabled_at = $1, totp_last_step = $2, updated_at = $1
+		WHERE id = $3 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`,
+		now, step, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func DisableTOTP(ctx context.Context, pool *pgxpool.Pool, userID uint) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $1
+		WHERE id = $2`,
+		time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep records the time step of an accepted code, rejecting a code
+// from the same or an earlier step than the last one used.
+func UseTOTPStep(ctx context.Context, pool *pgxpool.Pool, userID uint, step int64) error {
+	tag, err := pool.Exec(ctx,
+		`UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes discards existing recovery codes and stores the new hashes.
+func ReplaceRecoveryCodes(ctx context.Context, pool *pgxpool.Pool, userID uint, codeHashes []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)",
+			userID, hash, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used.
+func ConsumeRecoveryCode(ctx context.Context, pool *pgxpool.Pool, userID uint, codeHash string) error {
+	var id uint
+	err := pool.QueryRow(ctx,
+		`UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+		RETURNING id`,
+		time.Now(), userID, codeHash).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRecoveryCodeInvalid
+	}
+	return err
+}
+
+func CountRecoveryCodes(ctx context.Context, pool *pgxpool.Pool, userID uint) (int, error) {
+	var count int
+	err := pool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID).Scan(&count)
+	return count, err
+}
@@ -3,26 +3,35 @@ package models
 import (
 	"context"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
+	"go-turbo/pkg/password"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrEmailTaken = errors.New("email address is already in use")
+
 type User struct {
-	ID        uint      `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password,omitempty"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password,omitempty"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	TOTPEnabled     bool       `json:"two_factor_enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 func GetUserByEmail(ctx context.Context, pool *pgxpool.Pool, email string) (*User, error) {
 	var user User
 	err := pool.QueryRow(ctx,
-		"SELECT id, email, password, role, created_at, updated_at FROM users WHERE email = $1",
-		email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		"SELECT id, email, password, role, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at FROM users WHERE email = $1",
+		email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.TOTPEnabled, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -32,16 +41,27 @@ func GetUserByEmail(ctx context.Context, pool *pgxpool.Pool, email string) (*Use
 func GetUserByID(ctx context.Context, pool *pgxpool.Pool, id uint) (*User, error) {
 	var user User
 	err := pool.QueryRow(ctx,
-		"SELECT id, email, password, role, created_at, updated_at FROM users WHERE id = $1",
-		id).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		"SELECT id, email, password, role, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at FROM users WHERE id = $1",
+		id).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.TOTPEnabled, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// IsPlatformOperator reports whether the user may act on any account, not
+// just those in their organizations.
+func IsPlatformOperator(ctx context.Context, pool *pgxpool.Pool, userID uint) (bool, error) {
+	var operator bool
+	err := pool.QueryRow(ctx, "SELECT platform_operator FROM users WHERE id = $1", userID).Scan(&operator)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return operator, err
+}
+
 func CreateUser(ctx context.Context, pool *pgxpool.Pool, user *User) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(user.Password)
 	if err != nil {
 		return err
 	}
@@ -51,7 +71,7 @@ func CreateUser(ctx context.Context, pool *pgxpool.Pool, user *User) error {
 		`INSERT INTO users (email, password, role, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id`,
-		user.Email, string(hashedPassword), user.Role, now, now).Scan(&user.ID)
+		user.Email, hashedPassword, user.Role, now, now).Scan(&user.ID)
 	if err != nil {
 		return err
 	}
@@ -82,16 +102,136 @@ func GetAllUsers(ctx context.Context, pool *pgxpool.Pool) ([]User, error) {
 	return users, rows.Err()
 }
 
-func ValidateUserCredentials(ctx context.Context, pool *pgxpool.Pool, email, password string) (*User, error) {
+// ValidateUserCredentials checks the password and, on success, upgrades
+// bcrypt or outdated Argon2id hashes to the current parameters.
+func ValidateUserCredentials(ctx context.Context, pool *pgxpool.Pool, email, plaintext string) (*User, error) {
 	user, err := GetUserByEmail(ctx, pool, email)
 	if err != nil {
 		return nil, errors.New("invalid credentials")
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+	match, needsRehash, err := password.Verify(plaintext, user.Password)
+	if err != nil || !match {
 		return nil, errors.New("invalid credentials")
 	}
 
+	if needsRehash {
+		if err := rehashPassword(ctx, pool, user.ID, user.Password, plaintext); err != nil {
+			log.Printf("Error rehashing password for user %d: %v", user.ID, err)
+		}
+	}
+
 	user.Password = "" // Clear password before returning
 	return user, nil
 }
+
+func MarkEmailVerified(ctx context.Context, pool *pgxpool.Pool, userID uint) error {
+	_, err := pool.Exec(ctx,
+		"UPDATE users SET email_verified_at = $1, updated_at = $1 WHERE id = $2 AND email_verified_at IS NULL",
+		time.Now(), userID)
+	return err
+}
+
+func UpdateUserPassword(ctx context.Context, pool *pgxpool.Pool, userID uint, plaintext string) error {
+	hashedPassword, err := password.Hash(plaintext)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx,
+		"UPDATE users SET password = $1, password_changed_at = $2, updated_at = $2 WHERE id = $3",
+		hashedPassword, time.Now(), userID)
+	return err
+}
+
+// SetPendingEmail records an email address awaiting confirmation.
+func SetPendingEmail(ctx context.Context, pool *pgxpool.Pool, userID uint, email string) error {
+	var exists bool
+	err := pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)",
+		email).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	_, err = pool.Exec(ctx,
+		"UPDATE users SET pending_email = $1, updated_at = $2 WHERE id = $3",
+		email, time.Now(), userID)
+	return err
+}
+
+// ConfirmPendingEmail swaps in the pending address, marks it verified and
+// returns the previous and new addresses.
+func ConfirmPendingEmail(ctx context.Context, pool *pgxpool.Pool, userID uint) (oldEmail, newEmail string, err error) {
+	err = pool.QueryRow(ctx,
+		`UPDATE users u SET email = u.pending_email, pending_email = NULL, email_verified_at = $1, updated_at = $1
+		FROM (SELECT id, email FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE u.id = old.id AND u.pending_email IS NOT NULL
+		RETURNING old.email, u.email`,
+		time.Now(), userID).Scan(&oldEmail, &newEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrTokenInvalid
+	}
+
+	// The address may have been registered since the change was requested
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return "", "", ErrEmailTaken
+	}
+	return oldEmail, newEmail, err
+}
+
+// rehashPassword only replaces the hash it verified against, so a password
+// changed concurrently is never overwritten.
+func rehashPassword(ctx context.Context, pool *pgxpool.Pool, userID uint, oldHash, plaintext string) error {
+	hashedPassword, err := password.Hash(plaintext)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx,
+		"UPDATE users SET password = $1 WHERE id = $2 AND password = $3",
+		hashedPassword, userID, oldHash)
+	return err
+}
+
+// DeleteUser removes the user and everything that references them. Organizations
+// left without members are removed too.
+func DeleteUser(ctx context.Context, pool *pgxpool.Pool, userID uint) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	if err := tx.QueryRow(ctx, "SELECT email FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&email); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM organizations o
+		WHERE EXISTS (SELECT 1 FROM organization_members m WHERE m.organization_id = o.id AND m.user_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM organization_members m WHERE m.organization_id = o.id AND m.user_id <> $1)`,
+		userID)
+	if err != nil {
+		return err
+	}
+
+	// Account throttles are keyed by email rather than user ID
+	_, err = tx.Exec(ctx,
+		"DELETE FROM login_throttles WHERE scope = $1 AND key = $2",
+		ThrottleScopeAccount, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// CreateUserToken stores the hash of a single-use token. Outstanding tokens
+// for the same user and purpose are invalidated.
+func CreateUserToken(ctx context.Context, pool *pgxpool.Pool, userID uint, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	_, err = tx.Exec(ctx,
+		"UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL",
+		now, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		userID, purpose, tokenHash, expiresAt, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeUserToken marks a valid token as used and returns its user.
+func ConsumeUserToken(ctx context.Context, pool *pgxpool.Pool, purpose, tokenHash string) (uint, error) {
+	var userID uint
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`UPDATE user_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`,
+		now, tokenHash, purpose).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrTokenInvalid
+	}
+	return userID, err
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Webhook is an organization's subscription to its events. EventTypes holds
+// patterns such as "audit.role.update", "audit.*" or "analytics.user_signup".
+type Webhook struct {
+	ID          uint      `json:"id"`
+	OrgID       uint      `json:"org_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Enabled     bool      `json:"enabled"`
+	CreatedBy   *uint     `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one event queued for, or sent to, a webhook.
+type WebhookDelivery struct {
+	ID             uint64          `json:"id"`
+	WebhookID      uint            `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+func CreateWebhook(ctx context.Context, pool *pgxpool.Pool, hook *Webhook) error {
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`INSERT INTO webhooks (organization_id, url, description, secret, event_types, enabled, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING id`,
+		hook.OrgID, hook.URL, hook.Description, hook.Secret, hook.EventTypes, hook.Enabled, hook.CreatedBy, now).Scan(&hook.ID)
+	if err != nil {
+		return err
+	}
+	hook.CreatedAt = now
+	hook.UpdatedAt = now
+	return nil
+}
+
+const webhookColumns = `id, organization_id, url, description, secret, event_types, enabled, created_by, created_at, updated_at`
+
+func scanWebhook(row pgx.Row) (*Webhook, error) {
+	var hook Webhook
+	if err := row.Scan(&hook.ID, &hook.OrgID, &hook.URL, &hook.Description, &hook.Secret, &hook.EventTypes,
+		&hook.Enabled, &hook.CreatedBy, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func queryWebhooks(ctx context.Context, pool *pgxpool.Pool, query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+// GetWebhook returns the organization's webhook including its secret.
+func GetWebhook(ctx context.Context, pool *pgxpool.Pool, orgID, id uint) (*Webhook, error) {
+	return scanWebhook(pool.QueryRow(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND organization_id = $2`,
+		id, orgID))
+}
+
+// GetOrgWebhooks lists the organization's webhooks without their secrets.
+func GetOrgWebhooks(ctx context.Context, pool *pgxpool.Pool, orgID uint) ([]Webhook, error) {
+	hooks, err := queryWebhooks(ctx, pool,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE organization_id = $1 ORDER BY created_at`,
+		orgID)
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, err
+}
+
+// GetEnabledWebhooks returns every enabled webhook with its secret, for the
+// dispatcher.
+func GetEnabledWebhooks(ctx context.Context, pool *pgxpool.Pool) ([]Webhook, error) {
+	return queryWebhooks(ctx, pool, `SELECT `+webhookColumns+` FROM webhooks WHERE enabled`)
+}
+
+// UpdateWebhook saves the URL, description, event types and enabled flag.
+func UpdateWebhook(ctx context.Context, pool *pgxpool.Pool, hook *Webhook) error {
+	now := time.Now()
+	tag, err := pool.Exec(ctx,
+		`UPDATE webhooks SET url = $1, description = $2, event_types = $3, enabled = $4, updated_at = $5
+		WHERE id = $6 AND organization_id = $7`,
+		hook.URL, hook.Description, hook.EventTypes, hook.Enabled, now, hook.ID, hook.OrgID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	hook.UpdatedAt = now
+	return nil
+}
+
+func DeleteWebhook(ctx context.Context, pool *pgxpool.Pool, orgID, id uint) error {
+	tag, err := pool.Exec(ctx, "DELETE FROM webhooks WHERE id = $1 AND organization_id = $2", id, orgID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+	response_status, COALESCE(last_error, ''), created_at, delivered_at`
+
+func scanWebhookDeliveries(rows pgx.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateWebhookDelivery queues a delivery, due immediately unless Status is
+// already final.
+func CreateWebhookDelivery(ctx context.Context, pool *pgxpool.Pool, d *WebhookDelivery) error {
+	if d.Status == "" {
+		d.Status = WebhookDeliveryPending
+	}
+	now := time.Now()
+	err := pool.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id`,
+		d.WebhookID, d.EventType, d.Payload, d.Status, now).Scan(&d.ID)
+	if err != nil {
+		return err
+	}
+	d.NextAttemptAt = now
+	d.CreatedAt = now
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns up to limit pending deliveries that are
+// due and pushes their next attempt back by lease, so concurrent workers skip
+// them and a crashed worker's deliveries are retried after the lease.
+func ClaimDueWebhookDeliveries(ctx context.Context, pool *pgxpool.Pool, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	now := time.Now()
+	rows, err := pool.Query(ctx,
+		`UPDATE webhook_deliveries SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns,
+		now.Add(lease), WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// RecordWebhookAttempt stores the outcome of one delivery attempt. A pending
+// status schedules the next attempt at nextAttemptAt.
+func RecordWebhookAttempt(ctx context.Context, pool *pgxpool.Pool, id uint64, status string, responseStatus *int, lastError string, nextAttemptAt time.Time) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE webhook_deliveries SET
+			status = $1,
+			attempts = attempts + 1,
+			response_status = $2,
+			last_error = NULLIF($3, ''),
+			next_attempt_at = $4,
+			delivered_at = CASE WHEN $1 = 'succeeded' THEN now() ELSE delivered_at END
+		WHERE id = $5`,
+		status, responseStatus, lastError, nextAttemptAt, id)
+	return err
+}
+
+// GetWebhookDeliveries returns the webhook's most recent deliveries.
+func GetWebhookDeliveries(ctx context.Context, pool *pgxpool.Pool, webhookID uint, limit int) ([]WebhookDelivery, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// DeleteOldWebhookDeliveries removes finished deliveries created before cutoff.
+func DeleteOldWebhookDeliveries(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx,
+		"DELETE FROM webhook_deliveries WHERE status <> $1 AND created_at < $2",
+		WebhookDeliveryPending, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,108 @@
+package password
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PolicyError explains why a password was rejected. Its message is safe to
+// return to clients.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+// Policy is the set of rules new passwords must satisfy.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	breached  map[string]struct{}
+}
+
+// PolicyFromEnv reads PASSWORD_MIN_LENGTH (default 10), PASSWORD_MAX_LENGTH
+// (default 128) and PASSWORD_BREACHED_LIST, a local file with one known
+// breached password per line.
+func PolicyFromEnv() (*Policy, error) {
+	policy := &Policy{MinLength: 10, MaxLength: 128}
+
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", v)
+		}
+		policy.MinLength = n
+	}
+	if v := os.Getenv("PASSWORD_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < policy.MinLength {
+			return nil, fmt.Errorf("invalid PASSWORD_MAX_LENGTH %q", v)
+		}
+		policy.MaxLength = n
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if err := policy.LoadBreachedList(path); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// LoadBreachedList adds every non-empty line of the file to the breached set.
+// Matching is case-insensitive.
+func (p *Policy) LoadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	if p.breached == nil {
+		p.breached = map[string]struct{}{}
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading breached password list: %w", err)
+	}
+	return nil
+}
+
+// Check returns a *PolicyError when the password is not acceptable for the
+// account with the given email.
+func (p *Policy) Check(password, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &PolicyError{Reason: fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	if length > p.MaxLength {
+		return &PolicyError{Reason: fmt.Sprintf("password must be at most %d characters", p.MaxLength)}
+	}
+
+	lower := strings.ToLower(password)
+	if email != "" && lower == strings.ToLower(email) {
+		return &PolicyError{Reason: "password must not match the email address"}
+	}
+	if _, found := p.breached[lower]; found {
+		return &PolicyError{Reason: "password appears in a list of breached passwords"}
+	}
+	return nil
+}
+
+// IsPolicyError reports whether err came from Check.
+func IsPolicyError(err error) bool {
+	var policyErr *PolicyError
+	return errors.As(err, &policyErr)
+}
@@ -13,8 +13,9 @@ type RabbitMQ struct {
 }
 
 type Message struct {
-	Body []byte
-	msg  *amqp.Delivery
+	Body       []byte
+	RoutingKey string
+	msg        *amqp.Delivery
 }
 
 func (m *Message) Ack() {
@@ -63,7 +64,31 @@ func (r *RabbitMQ) DeclareQueue(name string) error {
 	return err
 }
 
+// DeclareExchange declares a durable topic exchange.
+func (r *RabbitMQ) DeclareExchange(name string) error {
+	return r.channel.ExchangeDeclare(
+		name,    // name
+		"topic", // kind
+		true,    // durable
+		false,   // auto-deleted
+		false,   // internal
+		false,   // no-wait
+		nil,     // arguments
+	)
+}
+
+// BindQueue routes messages published to exchange with a routing key matching
+// key to the queue.
+func (r *RabbitMQ) BindQueue(queueName, key, exchange string) error {
+	return r.channel.QueueBind(queueName, key, exchange, false, nil)
+}
+
 func (r *RabbitMQ) Publish(queueName string, data interface{}) error {
+	return r.PublishTo("", queueName, data)
+}
+
+// PublishTo publishes data as JSON to exchange with the given routing key.
+func (r *RabbitMQ) PublishTo(exchange, key string, data interface{}) error {
 	body, err := json.Marshal(data)
 	if err != nil {
 		return err
@@ -71,10 +96,10 @@ func (r *RabbitMQ) Publish(queueName string, data interface{}) error {
 
 	return r.channel.PublishWithContext(
 		context.Background(),
-		"",        // exchange
-		queueName, // routing key
-		false,     // mandatory
-		false,     // immediate
+		exchange, // exchange
+		key,      // routing key
+		false,    // mandatory
+		false,    // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
 			Body:        body,
@@ -96,12 +121,61 @@ func (r *RabbitMQ) Consume(queueName string) (<-chan Message, error) {
 		return nil, err
 	}
 
+	messages := make(chan Message)
+	go func() {
+		for msg := range msgs {
+			msg := msg // Ack and Nack need this delivery, not the loop variable
+			messages <- Message{
+				Body:       msg.Body,
+				RoutingKey: msg.RoutingKey,
+				msg:        &msg,
+			}
+		}
+		close(messages)
+	}()
+
+	return messages, nil
+}
+
+// Subscribe declares a private queue bound to exchange with key and returns
+// its messages. The queue is deleted when the connection closes, so only
+// messages published while subscribed are received. Messages are
+// acknowledged on delivery and must not be acked again.
+func (r *RabbitMQ) Subscribe(exchange, key string) (<-chan Message, error) {
+	q, err := r.channel.QueueDeclare(
+		"",    // name, chosen by the server
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.BindQueue(q.Name, key, exchange); err != nil {
+		return nil, err
+	}
+
+	msgs, err := r.channel.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	messages := make(chan Message)
 	go func() {
 		for msg := range msgs {
 			messages <- Message{
-				Body: msg.Body,
-				msg:  &msg,
+				Body:       msg.Body,
+				RoutingKey: msg.RoutingKey,
 			}
 		}
 		close(messages)
@@ -0,0 +1,359 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/queue"
+)
+
+// Queue receives a copy of every published event for the dispatcher.
+const Queue = "webhooks_queue"
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it fails.
+	MaxAttempts = 10
+	// baseBackoff doubles after every failed attempt, up to maxBackoff.
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+
+	requestTimeout = 10 * time.Second
+	// claimLease must exceed requestTimeout so a delivery in flight is not
+	// claimed twice.
+	claimLease   = time.Minute
+	claimBatch   = 20
+	pollInterval = time.Second
+
+	// subscriptionTTL is how long enabled webhooks are cached, and so how
+	// long changes take to reach the dispatcher.
+	subscriptionTTL = 30 * time.Second
+
+	// deliveryRetention is how long finished deliveries are kept.
+	deliveryRetention = 30 * 24 * time.Hour
+	cleanupInterval   = time.Hour
+)
+
+// ErrPrivateAddress is returned when a webhook URL resolves to a loopback,
+// private or link-local address.
+var ErrPrivateAddress = errors.New("webhook address is not publicly routable")
+
+// EventType names an event for subscriptions: "analytics.<event>" or
+// "audit.<resource>.<action>".
+func EventType(routingKey string, body []byte) (string, uint64, error) {
+	switch routingKey {
+	case events.RoutingKeyAnalytics:
+		var e models.AnalyticsEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return "", 0, err
+		}
+		return "analytics." + e.Event, e.OrgID, nil
+	case events.RoutingKeyAudit:
+		var l models.AuditLog
+		if err := json.Unmarshal(body, &l); err != nil {
+			return "", 0, err
+		}
+		return "audit." + l.Resource + "." + l.Action, l.OrgID, nil
+	}
+	return "", 0, fmt.Errorf("unknown routing key %q", routingKey)
+}
+
+// Matches reports whether eventType matches any pattern. A pattern is an exact
+// type, "*", or a prefix ending in "*" such as "audit.*".
+func Matches(patterns []string, eventType string) bool {
+	for _, p := range patterns {
+		if p == eventType || (strings.HasSuffix(p, "*") && strings.HasPrefix(eventType, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidURL reports whether rawURL can be used as a webhook endpoint.
+func ValidURL(rawURL string) bool {
+	req, err := http.NewRequest(http.MethodPost, rawURL, nil)
+	return err == nil && (req.URL.Scheme == "https" || req.URL.Scheme == "http") && req.URL.Host != ""
+}
+
+// Result is the outcome of one delivery attempt.
+type Result struct {
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (r Result) ok() bool {
+	return r.Error == ""
+}
+
+// Dispatcher turns events into deliveries for matching webhooks and sends
+// them. Deliveries are stored in Postgres before sending, so several backend
+// instances can share the work and retries survive restarts.
+type Dispatcher struct {
+	db     *database.Database
+	client *http.Client
+
+	mu       sync.Mutex
+	hooks    map[uint64][]models.Webhook
+	loadedAt time.Time
+}
+
+// NewDispatcher creates a dispatcher. Unless allowPrivate is set, webhooks
+// may only reach public addresses, so organization admins cannot use them to
+// probe internal services.
+func NewDispatcher(db *database.Database, allowPrivate bool) *Dispatcher {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Dispatcher{
+		db:     db,
+		client: &http.Client{Timeout: requestTimeout, Transport: transport},
+	}
+}
+
+// DeclareQueue creates the dispatcher's durable queue and binds it to every
+// event.
+func DeclareQueue(rabbitmq *queue.RabbitMQ) error {
+	if err := rabbitmq.DeclareQueue(Queue); err != nil {
+		return err
+	}
+	return rabbitmq.BindQueue(Queue, "#", events.Exchange)
+}
+
+// Run queues deliveries for msgs until the channel closes or ctx is
+// cancelled.
+func (d *Dispatcher) Run(ctx context.Context, msgs <-chan queue.Message) {
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				log.Printf("Webhook queue closed")
+				return
+			}
+			if err := d.enqueue(ctx, msg); err != nil {
+				log.Printf("Error queueing webhook deliveries: %v", err)
+				msg.Nack(true)
+				time.Sleep(pollInterval) // let the database recover before the redelivery
+				continue
+			}
+			msg.Ack()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, msg queue.Message) error {
+	eventType, orgID, err := EventType(msg.RoutingKey, msg.Body)
+	if err != nil {
+		log.Printf("Skipping undecodable event for webhooks: %v", err)
+		return nil
+	}
+
+	hooks, err := d.subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks[orgID] {
+		if !Matches(hook.EventTypes, eventType) {
+			continue
+		}
+		delivery := models.WebhookDelivery{WebhookID: hook.ID, EventType: eventType, Payload: msg.Body}
+		if err := models.CreateWebhookDelivery(ctx, d.db.Pool, &delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscriptions returns enabled webhooks by organization, reloading them
+// every subscriptionTTL.
+func (d *Dispatcher) subscriptions(ctx context.Context) (map[uint64][]models.Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.hooks != nil && time.Since(d.loadedAt) < subscriptionTTL {
+		return d.hooks, nil
+	}
+	hooks, err := models.GetEnabledWebhooks(ctx, d.db.Pool)
+	if err != nil {
+		return nil, err
+	}
+	byOrg := make(map[uint64][]models.Webhook)
+	for _, hook := range hooks {
+		byOrg[uint64(hook.OrgID)] = append(byOrg[uint64(hook.OrgID)], hook)
+	}
+	d.hooks, d.loadedAt = byOrg, time.Now()
+	return byOrg, nil
+}
+
+// RunWorker sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) RunWorker(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(cleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+			d.sendDue(ctx)
+		case <-cleanup.C:
+			if n, err := models.DeleteOldWebhookDeliveries(ctx, d.db.Pool, time.Now().Add(-deliveryRetention)); err != nil {
+				log.Printf("Error deleting old webhook deliveries: %v", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d old webhook deliveries", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	deliveries, err := models.ClaimDueWebhookDeliveries(ctx, d.db.Pool, claimBatch, claimLease)
+	if err != nil {
+		log.Printf("Error claiming webhook deliveries: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery models.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) {
+	var result Result
+	retry := delivery.Attempts+1 < MaxAttempts
+	hook, err := d.webhook(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, errWebhookGone):
+		result, retry = Result{Error: "webhook was deleted or disabled"}, false
+	case err != nil:
+		log.Printf("Error loading webhook %d: %v", delivery.WebhookID, err)
+		return // retried after the claim lease
+	default:
+		result = d.Send(ctx, hook, delivery)
+	}
+
+	status, next := models.WebhookDeliverySucceeded, time.Now()
+	if !result.ok() {
+		status = models.WebhookDeliveryFailed
+		if retry {
+			status, next = models.WebhookDeliveryPending, time.Now().Add(backoff(delivery.Attempts+1))
+		}
+	}
+
+	var responseStatus *int
+	if result.StatusCode != 0 {
+		responseStatus = &result.StatusCode
+	}
+	if err := models.RecordWebhookAttempt(ctx, d.db.Pool, delivery.ID, status, responseStatus, result.Error, next); err != nil {
+		log.Printf("Error recording webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+var errWebhookGone = errors.New("webhook gone")
+
+// webhook looks up an enabled webhook by ID in the subscription cache.
+func (d *Dispatcher) webhook(ctx context.Context, id uint) (models.Webhook, error) {
+	hooks, err := d.subscriptions(ctx)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	for _, orgHooks := range hooks {
+		for _, hook := range orgHooks {
+			if hook.ID == id {
+				return hook, nil
+			}
+		}
+	}
+	return models.Webhook{}, errWebhookGone
+}
+
+// backoff returns the delay before the attempt after the given number of
+// failed attempts.
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Send makes one signed delivery attempt. Any 2xx response is a success.
+func (d *Dispatcher) Send(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) Result {
+	body, err := json.Marshal(struct {
+		ID        uint64          `json:"id"`
+		Type      string          `json:"type"`
+		CreatedAt time.Time       `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}{delivery.ID, delivery.EventType, delivery.CreatedAt, delivery.Payload})
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-turbo-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", strconv.FormatUint(uint64(hook.ID), 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{StatusCode: resp.StatusCode, Error: "endpoint returned " + resp.Status}
+	}
+	return Result{StatusCode: resp.StatusCode}
+}
@@ -1,5 +1,8 @@
 #!/bin/bash
 
+# Migrates Postgres (golang-migrate, migrations/) and ClickHouse
+# (pkg/cmd/clickhouse-migrate, migrations/clickhouse/). Run before starting services.
+
 # Check if migrate tool is installed
 if ! command -v migrate &> /dev/null; then
     echo "golang-migrate not found. Installing..."
@@ -7,20 +10,62 @@ if ! command -v migrate &> /dev/null; then
 fi
 
 # Load environment variables
+set -a
 source .env
+set +a
 
 # Construct database URL
 DB_URL="postgres://${DB_USER}:${DB_PASSWORD}@${DB_HOST}:${DB_PORT}/${DB_NAME}?sslmode=disable"
 
 # Default to "up" if no direction specified
 DIRECTION=${1:-up}
+ARG=$2
+
+clickhouse_migrate() {
+    (cd pkg && go run ./cmd/clickhouse-migrate -path ../migrations/clickhouse "$@")
+}
 
-echo "Running migrations ${DIRECTION}..."
-migrate -database "${DB_URL}" -path migrations "${DIRECTION}"
+case "${DIRECTION}" in
+    up)
+        echo "Running Postgres migrations up..."
+        migrate -database "${DB_URL}" -path migrations up || { echo "Postgres migration failed!"; exit 1; }
+        echo "Running ClickHouse migrations up..."
+        clickhouse_migrate up || { echo "ClickHouse migration failed!"; exit 1; }
+        ;;
+    down)
+        # Without a count everything is reverted, which drops all data in both
+        # databases, so confirm once before touching either
+        if [ -z "${ARG}" ]; then
+            read -r -p "Revert ALL Postgres and ClickHouse migrations? [y/N] " CONFIRM
+            if [ "${CONFIRM}" != "y" ] && [ "${CONFIRM}" != "Y" ]; then
+                echo "Not reverting migrations"
+                exit 1
+            fi
+            PG_ARG="-all"
+            CH_ARG="all"
+        else
+            PG_ARG="${ARG}"
+            CH_ARG="${ARG}"
+        fi
+        echo "Running Postgres migrations down..."
+        migrate -database "${DB_URL}" -path migrations down ${PG_ARG} || { echo "Postgres migration failed!"; exit 1; }
+        echo "Running ClickHouse migrations down..."
+        clickhouse_migrate down ${CH_ARG} || { echo "ClickHouse migration failed!"; exit 1; }
+        ;;
+    force)
+        migrate -database "${DB_URL}" -path migrations force "${ARG}" || { echo "Migration failed!"; exit 1; }
+        ;;
+    clickhouse-force)
+        clickhouse_migrate force "${ARG}" || { echo "Migration failed!"; exit 1; }
+        ;;
+    version)
+        echo "Postgres: $(migrate -database "${DB_URL}" -path migrations version 2>&1)"
+        echo "ClickHouse: $(clickhouse_migrate version)"
+        ;;
+    *)
+        echo "Unknown command ${DIRECTION}"
+        exit 1
+        ;;
+esac
 
-if [ $? -eq 0 ]; then
-    echo "Migrations completed successfully!"
-else
-    echo "Migration failed!"
-    exit 1
-fi 
\ No newline at end of file
+echo "Migrations completed successfully!"
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-turbo/pkg/alerting"
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/queue"
+
+	"github.com/joho/godotenv"
+)
+
+// The alerting service evaluates alert rules against every published event.
+// Windows are kept in memory, so only one instance consumes alerts_queue at a
+// time; further instances wait as standbys.
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Error loading .env file: %v", err)
+	}
+
+	rulesFile := os.Getenv("ALERT_RULES_FILE")
+	if rulesFile == "" {
+		log.Fatalf("ALERT_RULES_FILE is not set")
+	}
+	alertConfig, err := alerting.LoadConfig(rulesFile)
+	if err != nil {
+		log.Fatalf("Failed to load alert rules: %v", err)
+	}
+
+	// Initialize database
+	db, err := database.NewDatabase(database.Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Wait until no other instance is running the engine
+	log.Printf("Waiting to become the active alerting instance")
+	leaderCtx, release, err := alerting.AcquireLeadership(ctx, db)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Fatalf("Failed to acquire alerting lock: %v", err)
+	}
+	defer release()
+
+	// Initialize RabbitMQ
+	rabbitmq, err := queue.NewRabbitMQ(os.Getenv("RABBITMQ_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	}
+	defer rabbitmq.Close()
+
+	if err := alerting.DeclareQueue(rabbitmq); err != nil {
+		log.Fatalf("Failed to declare alerting queue: %v", err)
+	}
+	msgs, err := rabbitmq.Consume(alerting.Queue)
+	if err != nil {
+		log.Fatalf("Failed to consume alerting queue: %v", err)
+	}
+
+	log.Printf("Alerting service started with %d rules from %s", len(alertConfig.Rules), rulesFile)
+	alerting.NewEngine(alertConfig, db, mailer.NewFromEnv()).Run(leaderCtx, msgs)
+
+	// Another instance may already have taken over, so stop consuming and
+	// exit with an error to be restarted as a standby
+	if ctx.Err() == nil && leaderCtx.Err() != nil {
+		release()
+		rabbitmq.Close()
+		log.Fatalf("Alerting lock lost; stopping")
+	}
+	log.Println("Shutting down alerting service...")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// keyCacheTTL is how long a resolved API key is trusted, and so how long
+	// revoking a key or its permission takes to reach ingest.
+	keyCacheTTL = 30 * time.Second
+	// maxCachedKeys bounds the key cache.
+	maxCachedKeys = 10000
+)
+
+var errKeyNotAllowed = errors.New("api key cannot send events")
+
+type cachedKey struct {
+	orgID    uint64
+	loadedAt time.Time
+}
+
+// keyAuth authenticates ingest requests with an organization's API key. The
+// key must carry events:write and its owner must still hold it and belong to
+// the key's organization; events are stored under that organization.
+type keyAuth struct {
+	db *database.Database
+
+	mu   sync.Mutex
+	keys map[string]cachedKey // by key hash
+}
+
+func newKeyAuth(db *database.Database) *keyAuth {
+	return &keyAuth{db: db, keys: make(map[string]cachedKey)}
+}
+
+// require rejects requests without a valid events:write key and stores the
+// key's organization as orgID.
+func (a *keyAuth) require() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" || !auth.IsAPIKey(bearerToken[1]) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "An API key is required"})
+			c.Abort()
+			return
+		}
+
+		orgID, err := a.resolve(c.Request.Context(), auth.HashToken(bearerToken[1]))
+		if errors.Is(err, errKeyNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the events:write permission"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, models.ErrAPIKeyInvalid) {
+				log.Printf("Error authenticating API key: %v", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set("orgID", orgID)
+		c.Next()
+	}
+}
+
+// resolve returns the organization of the key with hash keyHash.
+func (a *keyAuth) resolve(ctx context.Context, keyHash string) (uint64, error) {
+	a.mu.Lock()
+	cached, ok := a.keys[keyHash]
+	a.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < keyCacheTTL {
+		return cached.orgID, nil
+	}
+
+	key, err := models.GetActiveAPIKeyByHash(ctx, a.db.Pool, keyHash)
+	if err != nil {
+		return 0, err
+	}
+	if !hasPermission(key.Scopes, models.PermissionEventsWrite) {
+		return 0, errKeyNotAllowed
+	}
+
+	// Like the backend, the owner's current role in the key's organization
+	// bounds the key
+	member, err := models.GetMembership(ctx, a.db.Pool, key.OrgID, key.UserID)
+	if err != nil {
+		return 0, models.ErrAPIKeyInvalid
+	}
+	rolePermissions, err := models.GetRolePermissions(ctx, a.db.Pool, models.MemberRole(member.Role))
+	if err != nil {
+		return 0, err
+	}
+	if !hasPermission(rolePermissions, models.PermissionEventsWrite) {
+		return 0, errKeyNotAllowed
+	}
+
+	a.store(keyHash, cachedKey{orgID: uint64(key.OrgID), loadedAt: time.Now()})
+	return uint64(key.OrgID), nil
+}
+
+// store caches a resolved key, dropping expired entries once the cache is
+// full. Keys are only cached after they resolve, so the cache holds at most
+// the organizations' own active keys.
+func (a *keyAuth) store(keyHash string, key cachedKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.keys) >= maxCachedKeys {
+		for hash, k := range a.keys {
+			if time.Since(k.loadedAt) >= keyCacheTTL {
+				delete(a.keys, hash)
+			}
+		}
+		if len(a.keys) >= maxCachedKeys {
+			return
+		}
+	}
+	a.keys[keyHash] = key
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/database/clickhouse"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxBatchBytes caps a batch body both as sent and after decompression.
+	maxBatchBytes = 5 << 20
+	// maxBatchEvents caps the number of events in one batch.
+	maxBatchEvents = 1000
+	// maxEventNameLength caps the event name of tracked events.
+	maxEventNameLength = 128
+	// maxFutureSkew is how far ahead of the server clock a timestamp may be.
+	maxFutureSkew = time.Hour
+)
+
+var (
+	errBatchTooLarge       = fmt.Errorf("batch exceeds %d bytes", maxBatchBytes)
+	errTooManyEvents       = fmt.Errorf("batch exceeds %d events", maxBatchEvents)
+	errUnsupportedEncoding = errors.New("Content-Encoding must be gzip or identity")
+	errOrgMismatch         = errors.New("org_id does not match the API key")
+)
+
+// batchItemResult reports whether one event of a batch was accepted.
+type batchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validateEvent checks a tracked event sent with a key for orgID, sets its
+// organization and fills in a missing timestamp. An org_id in the event is
+// optional but must match the key.
+func validateEvent(event *models.AnalyticsEvent, orgID uint64, now time.Time) error {
+	switch {
+	case event.Event == "":
+		return errors.New("event is required")
+	case len(event.Event) > maxEventNameLength:
+		return fmt.Errorf("event must be at most %d characters", maxEventNameLength)
+	case event.OrgID != 0 && event.OrgID != orgID:
+		return errOrgMismatch
+	case event.Timestamp.After(now.Add(maxFutureSkew)):
+		return errors.New("timestamp is in the future")
+	}
+	if err := event.Properties.Validate(); err != nil {
+		return err
+	}
+	event.OrgID = orgID
+	if event.Timestamp.IsZero() {
+		event.Timestamp = now
+	}
+	return nil
+}
+
+// batchBody returns the request body with any gzip encoding removed. Both
+// the body as sent and the decompressed body are limited to maxBatchBytes.
+func batchBody(c *gin.Context) (io.Reader, error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBytes)
+	switch strings.ToLower(c.GetHeader("Content-Encoding")) {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return io.LimitReader(gz, maxBatchBytes+1), nil
+	}
+	return nil, errUnsupportedEncoding
+}
+
+// splitBatch returns the raw items of a JSON array body, or of an NDJSON
+// body when the content type is application/x-ndjson or application/jsonl.
+// Blank NDJSON lines are skipped.
+func splitBatch(contentType string, body []byte) ([]json.RawMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-ndjson" && mediaType != "application/jsonl" {
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, errors.New("body must be a JSON array of events")
+		}
+		if len(items) > maxBatchEvents {
+			return nil, errTooManyEvents
+		}
+		return items, nil
+	}
+
+	var items []json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64<<10), maxBatchBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(items) == maxBatchEvents {
+			return nil, errTooManyEvents
+		}
+		items = append(items, json.RawMessage(append([]byte(nil), line...)))
+	}
+	return items, scanner.Err()
+}
+
+// trackBatch stores a batch of events sent as a JSON array or as NDJSON,
+// optionally gzip-compressed. Invalid events are rejected or quarantined
+// individually and the rest are written; the response lists the outcome of
+// every event.
+func (in *ingester) trackBatch(c *gin.Context) {
+	reader, err := batchBody(c)
+	if errors.Is(err, errUnsupportedEncoding) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(reader)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || len(body) > maxBatchBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": errBatchTooLarge.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading request body"})
+		return
+	}
+
+	items, err := splitBatch(c.ContentType(), body)
+	if errors.Is(err, errTooManyEvents) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch contains no events"})
+		return
+	}
+
+	orgID := c.GetUint64("orgID")
+	now := time.Now()
+	results := make([]batchItemResult, len(items))
+	accepted := make([]models.AnalyticsEvent, 0, len(items))
+	var quarantined []clickhouse.QuarantinedEvent
+	for i, item := range items {
+		results[i].Index = i
+		var event models.AnalyticsEvent
+		if err := json.Unmarshal(item, &event); err != nil {
+			results[i].Status, results[i].Error = statusRejected, "invalid event: "+err.Error()
+			continue
+		}
+		if err := validateEvent(&event, orgID, now); err != nil {
+			results[i].Status, results[i].Error = statusRejected, err.Error()
+			continue
+		}
+
+		status, problems, err := in.screen(c.Request.Context(), event)
+		if err != nil {
+			log.Printf("Error validating event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate events"})
+			return
+		}
+		results[i].Status, results[i].Error = status, strings.Join(problems, "; ")
+		switch status {
+		case statusAccepted:
+			accepted = append(accepted, event)
+		case statusQuarantined:
+			quarantined = append(quarantined, clickhouse.QuarantinedEvent{ReceivedAt: now, Event: event, Errors: problems})
+		}
+	}
+
+	if err := in.store(c.Request.Context(), accepted, quarantined); err != nil {
+		log.Printf("Error storing analytics batch: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accepted":    len(accepted),
+		"quarantined": len(quarantined),
+		"rejected":    len(items) - len(accepted) - len(quarantined),
+		"results":     results,
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go-turbo/pkg/models"
+)
+
+func TestValidateEventBindsKeyOrganization(t *testing.T) {
+	now := time.Now()
+
+	event := models.AnalyticsEvent{Event: "page_view"}
+	if err := validateEvent(&event, 7, now); err != nil {
+		t.Fatalf("event without org_id: %v", err)
+	}
+	if event.OrgID != 7 || event.Timestamp.IsZero() {
+		t.Fatalf("event = %+v, want org 7 and a timestamp", event)
+	}
+
+	event = models.AnalyticsEvent{Event: "page_view", OrgID: 7}
+	if err := validateEvent(&event, 7, now); err != nil {
+		t.Fatalf("event with matching org_id: %v", err)
+	}
+
+	event = models.AnalyticsEvent{Event: "page_view", OrgID: 8}
+	if err := validateEvent(&event, 7, now); err != errOrgMismatch {
+		t.Fatalf("event for another organization: err = %v, want %v", err, errOrgMismatch)
+	}
+
+	event = models.AnalyticsEvent{Event: "page_view", Timestamp: now.Add(2 * maxFutureSkew)}
+	if err := validateEvent(&event, 7, now); err == nil {
+		t.Fatal("event in the future was accepted")
+	}
+}
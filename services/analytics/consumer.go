@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/queue"
+)
+
+// consumeConcurrency bounds how many queued events are being stored at once.
+// Each waits for its batch to be written, so events must be handled
+// concurrently for batches to fill.
+const consumeConcurrency = 512
+
+// consume stores the events published by other services to the analytics
+// queue until msgs is closed. Events that fail to store are requeued.
+func (in *ingester) consume(ctx context.Context, msgs <-chan queue.Message) {
+	sem := make(chan struct{}, consumeConcurrency)
+	for msg := range msgs {
+		var event models.AnalyticsEvent
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			log.Printf("Error parsing message: %v", err)
+			msg.Nack(false) // Negative acknowledgment, don't requeue
+			continue
+		}
+
+		now := time.Now()
+		if event.Timestamp.IsZero() {
+			event.Timestamp = now
+		}
+
+		sem <- struct{}{}
+		go func(msg queue.Message, event models.AnalyticsEvent) {
+			defer func() { <-sem }()
+
+			status, problems, err := in.ingest(ctx, event, now)
+			if err != nil {
+				log.Printf("Error ingesting queued event: %v", err)
+				msg.Nack(true)
+				return
+			}
+			if status == statusRejected {
+				log.Printf("Dropped %s event for org %d: %v", event.Event, event.OrgID, problems)
+			}
+			msg.Ack()
+		}(msg, event)
+	}
+}
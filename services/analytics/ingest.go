@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-turbo/pkg/database/clickhouse"
+	"go-turbo/pkg/eventschema"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Outcomes of an ingested event
+const (
+	statusAccepted    = "accepted"
+	statusRejected    = "rejected"
+	statusQuarantined = "quarantined"
+)
+
+// ingester screens events against their organization's schemas and stores
+// them: valid events in analytics_events, invalid ones in quarantine when
+// the organization asks for it.
+type ingester struct {
+	writer   *clickhouse.AnalyticsWriter
+	client   *clickhouse.Client
+	registry *eventschema.Registry
+}
+
+func newIngester(writer *clickhouse.AnalyticsWriter, client *clickhouse.Client, registry *eventschema.Registry) *ingester {
+	return &ingester{writer: writer, client: client, registry: registry}
+}
+
+// screen returns what happens to event under its organization's validation
+// mode, and the schema problems found.
+func (in *ingester) screen(ctx context.Context, event models.AnalyticsEvent) (string, []string, error) {
+	result, err := in.registry.Check(ctx, event)
+	if err != nil {
+		return "", nil, err
+	}
+	switch {
+	case result.Valid():
+		return statusAccepted, nil, nil
+	case result.Mode == models.EventValidationQuarantine:
+		return statusQuarantined, result.Errors, nil
+	}
+	return statusRejected, result.Errors, nil
+}
+
+// store writes accepted events through the batched writer and quarantined
+// events directly.
+func (in *ingester) store(ctx context.Context, accepted []models.AnalyticsEvent, quarantined []clickhouse.QuarantinedEvent) error {
+	if len(quarantined) > 0 {
+		if err := in.client.InsertQuarantinedEvents(ctx, quarantined); err != nil {
+			return err
+		}
+	}
+	return in.writer.Write(ctx, accepted)
+}
+
+// ingest screens and stores a single event received at now, returning its
+// status and any schema problems. Rejected events are not stored.
+func (in *ingester) ingest(ctx context.Context, event models.AnalyticsEvent, now time.Time) (string, []string, error) {
+	status, problems, err := in.screen(ctx, event)
+	if err != nil {
+		return "", nil, fmt.Errorf("error validating event: %w", err)
+	}
+
+	var accepted []models.AnalyticsEvent
+	var quarantined []clickhouse.QuarantinedEvent
+	switch status {
+	case statusRejected:
+		return status, problems, nil
+	case statusQuarantined:
+		quarantined = append(quarantined, clickhouse.QuarantinedEvent{ReceivedAt: now, Event: event, Errors: problems})
+	default:
+		accepted = append(accepted, event)
+	}
+
+	if err := in.store(ctx, accepted, quarantined); err != nil {
+		return "", nil, fmt.Errorf("error storing event: %w", err)
+	}
+	return status, problems, nil
+}
+
+// track stores a single event for the organization of the request's API
+// key.
+func (in *ingester) track(c *gin.Context) {
+	var event models.AnalyticsEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	err := validateEvent(&event, c.GetUint64("orgID"), now)
+	if errors.Is(err, errOrgMismatch) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, problems, err := in.ingest(c.Request.Context(), event, now)
+	if err != nil {
+		log.Printf("Error ingesting event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store event"})
+		return
+	}
+
+	if status == statusRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event does not match its schema", "details": problems})
+		return
+	}
+	if status == statusQuarantined {
+		c.JSON(http.StatusAccepted, gin.H{"status": status, "details": problems})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -9,8 +9,10 @@ import (
 	"syscall"
 	"time"
 
+	"go-turbo/pkg/database"
 	"go-turbo/pkg/database/clickhouse"
-	"go-turbo/pkg/models"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/eventschema"
 	"go-turbo/pkg/queue"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +37,19 @@ func main() {
 	}
 	defer rabbitmq.Close()
 
+	// Initialize database
+	db, err := database.NewDatabase(database.Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
 	// Initialize ClickHouse
 	clickhouseClient, err := clickhouse.NewClient(
 		os.Getenv("CLICKHOUSE_HOST"),
@@ -49,33 +64,41 @@ func main() {
 
 	ctx := context.Background()
 
-	// Create analytics table
-	if err := clickhouseClient.CreateAnalyticsTable(ctx); err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+	// Tables are created by make migrate-up
+	if err := clickhouseClient.CheckMigrated(ctx); err != nil {
+		log.Fatalf("ClickHouse schema not ready: %v", err)
 	}
 
-	// Initialize Gin router
-	r := gin.Default()
+	// Events from all requests are written in batches
+	writer := clickhouse.NewAnalyticsWriter(clickhouseClient, clickhouse.DefaultWriterBatchSize, clickhouse.DefaultWriterFlushInterval)
+	writerCtx, stopWriter := context.WithCancel(context.Background())
+	writerDone := make(chan struct{})
+	go func() {
+		writer.Run(writerCtx)
+		close(writerDone)
+	}()
 
-	// Setup routes
-	r.POST("/track", func(c *gin.Context) {
-		var event models.AnalyticsEvent
-		if err := c.ShouldBindJSON(&event); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	// Events are checked against schemas registered in Postgres
+	ingest := newIngester(writer, clickhouseClient, eventschema.NewRegistry(db))
 
-		if event.Timestamp.IsZero() {
-			event.Timestamp = time.Now()
-		}
+	// Store the events published by the other services
+	if err := events.DeclareTopology(rabbitmq); err != nil {
+		log.Fatalf("Failed to declare queues: %v", err)
+	}
+	msgs, err := rabbitmq.Consume(events.AnalyticsQueue)
+	if err != nil {
+		log.Fatalf("Failed to consume queue: %v", err)
+	}
+	go ingest.consume(writerCtx, msgs)
 
-		if err := clickhouseClient.InsertAnalyticsEvent(c.Request.Context(), event); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store event"})
-			return
-		}
+	// Initialize Gin router
+	r := gin.Default()
 
-		c.JSON(http.StatusOK, gin.H{"status": "success"})
-	})
+	// Setup routes. Clients send events with an events:write API key, which
+	// decides the organization they are stored under.
+	keys := newKeyAuth(db)
+	r.POST("/track", keys.require(), ingest.track)
+	r.POST("/track/batch", keys.require(), ingest.trackBatch)
 
 	// Start server
 	port := os.Getenv("ANALYTICS_PORT")
@@ -108,4 +131,8 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+
+	// Write events still waiting for a batch
+	stopWriter()
+	<-writerDone
 }
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"go-turbo/pkg/database/clickhouse"
+	"go-turbo/pkg/events"
 	"go-turbo/pkg/models"
 	"go-turbo/pkg/queue"
 
@@ -52,18 +53,18 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create audit logs table
-	if err := clickhouseClient.CreateAuditLogsTable(ctx); err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+	// Tables are created by make migrate-up
+	if err := clickhouseClient.CheckMigrated(ctx); err != nil {
+		log.Fatalf("ClickHouse schema not ready: %v", err)
 	}
 
-	// Declare queue
-	if err := rabbitmq.DeclareQueue("audit_logs_queue"); err != nil {
-		log.Fatalf("Failed to declare queue: %v", err)
+	// Declare the events exchange and queues
+	if err := events.DeclareTopology(rabbitmq); err != nil {
+		log.Fatalf("Failed to declare queues: %v", err)
 	}
 
 	// Start consuming messages
-	msgs, err := rabbitmq.Consume("audit_logs_queue")
+	msgs, err := rabbitmq.Consume(events.AuditLogsQueue)
 	if err != nil {
 		log.Fatalf("Failed to consume queue: %v", err)
 	}
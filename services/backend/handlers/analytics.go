@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"go-turbo/pkg/database/clickhouse"
 	"go-turbo/pkg/models"
@@ -19,7 +22,8 @@ func NewAnalyticsHandler(clickhouse *clickhouse.Client) *AnalyticsHandler {
 	return &AnalyticsHandler{clickhouse: clickhouse}
 }
 
-func (h *AnalyticsHandler) GetEvents(c *gin.Context) {
+// queryUserID reads the user_id query parameter, defaulting to the caller.
+func queryUserID(c *gin.Context) (uint64, bool) {
 	userID := c.Query("user_id")
 	if userID == "" {
 		// If no user_id provided, get current user's ID from context
@@ -27,7 +31,7 @@ func (h *AnalyticsHandler) GetEvents(c *gin.Context) {
 			userID = strconv.FormatUint(id.(uint64), 10)
 		} else {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID not found"})
-			return
+			return 0, false
 		}
 	}
 
@@ -36,11 +40,21 @@ func (h *AnalyticsHandler) GetEvents(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error parsing user ID: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uid, true
+}
+
+func (h *AnalyticsHandler) GetEvents(c *gin.Context) {
+	uid, ok := queryUserID(c)
+	if !ok {
 		return
 	}
 
-	// Get events from ClickHouse
-	events, err := h.clickhouse.GetAnalyticsEvents(c.Request.Context(), uid)
+	orgID, _ := c.Get("orgID")
+
+	// Get events from ClickHouse, scoped to the caller's organization
+	events, err := h.clickhouse.GetAnalyticsEvents(c.Request.Context(), orgID.(uint64), uid)
 	if err != nil {
 		log.Printf("Error fetching analytics events: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics events", "details": err.Error()})
@@ -53,3 +67,411 @@ func (h *AnalyticsHandler) GetEvents(c *gin.Context) {
 
 	c.JSON(http.StatusOK, events)
 }
+
+// maxAnalyticsRange bounds dashboard queries so a single request cannot scan
+// years of raw events.
+const maxAnalyticsRange = 366 * 24 * time.Hour
+
+// parseTimeRange reads the RFC 3339 from and to query parameters. Missing
+// values default to the last window ending at the current bucket boundary, so
+// the default range can be served from rollups.
+func parseTimeRange(c *gin.Context, window, bucket time.Duration) (time.Time, time.Time, bool) {
+	to := time.Now().UTC().Truncate(bucket).Add(bucket)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC 3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	from := to.Add(-window)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC 3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > maxAnalyticsRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time range is too long"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// GetHourlyEventCounts returns per-hour event counts for the caller's
+// organization, defaulting to the last 24 hours.
+func (h *AnalyticsHandler) GetHourlyEventCounts(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	counts, err := h.clickhouse.GetHourlyEventCounts(c.Request.Context(), orgID.(uint64), from, to)
+	if err != nil {
+		log.Printf("Error fetching hourly event counts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event counts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "counts": counts})
+}
+
+// GetDailyActiveUsers returns distinct users per UTC day for the caller's
+// organization, defaulting to the last 30 days.
+func (h *AnalyticsHandler) GetDailyActiveUsers(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour, 24*time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	days, err := h.clickhouse.GetDailyActiveUsers(c.Request.Context(), orgID.(uint64), from, to)
+	if err != nil {
+		log.Printf("Error fetching daily active users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch active users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "days": days})
+}
+
+// GetEndpointLatency returns latency and payload size percentiles per route
+// for the caller's organization, defaulting to the last 24 hours.
+func (h *AnalyticsHandler) GetEndpointLatency(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	endpoints, err := h.clickhouse.GetEndpointLatency(c.Request.Context(), orgID.(uint64), from, to)
+	if err != nil {
+		log.Printf("Error fetching endpoint latency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch endpoint latency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "endpoints": endpoints})
+}
+
+// GetRouteLatency returns one route's latency and payload size percentiles
+// per hour, defaulting to the last 24 hours. The route is the template, such
+// as /api/admin/users/:id, as listed by GetEndpointLatency.
+func (h *AnalyticsHandler) GetRouteLatency(c *gin.Context) {
+	method := strings.ToUpper(c.Query("method"))
+	route := c.Query("route")
+	if method == "" || route == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method and route are required"})
+		return
+	}
+	from, to, ok := parseTimeRange(c, 24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	hours, err := h.clickhouse.GetRouteLatency(c.Request.Context(), orgID.(uint64), method, route, from, to)
+	if err != nil {
+		log.Printf("Error fetching route latency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch route latency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "method": method, "route": route, "hours": hours})
+}
+
+// maxFunnelWindow bounds how long after the first step later steps may happen.
+const maxFunnelWindow = 90 * 24 * time.Hour
+
+// FunnelStepResult is one step of a funnel response. ConversionRate is relative
+// to the first step and DropOff counts users lost since the previous step.
+type FunnelStepResult struct {
+	clickhouse.FunnelStep
+	Users          uint64  `json:"users"`
+	ConversionRate float64 `json:"conversion_rate"`
+	DropOff        uint64  `json:"drop_off"`
+}
+
+// GetFunnel counts how many users completed each of the ordered steps within
+// the conversion window. from and to bound when the first step happened and
+// default to the last 30 days.
+func (h *AnalyticsHandler) GetFunnel(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Steps         []clickhouse.FunnelStep `json:"steps"`
+		WindowSeconds int64                   `json:"window_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Steps) < 2 || req.WindowSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if len(req.Steps) > clickhouse.MaxFunnelSteps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many funnel steps"})
+		return
+	}
+	for _, step := range req.Steps {
+		if step.Event == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every step needs an event"})
+			return
+		}
+		if err := step.Properties.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	window := 7 * 24 * time.Hour
+	if req.WindowSeconds > 0 {
+		window = time.Duration(req.WindowSeconds) * time.Second
+	}
+	if window > maxFunnelWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Conversion window is too long"})
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	reached, err := h.clickhouse.GetFunnel(c.Request.Context(), orgID.(uint64), req.Steps, window, from, to)
+	if err != nil {
+		log.Printf("Error computing funnel: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute funnel"})
+		return
+	}
+
+	steps := make([]FunnelStepResult, len(req.Steps))
+	for i, step := range req.Steps {
+		steps[i] = FunnelStepResult{FunnelStep: step, Users: reached[i]}
+		if reached[0] > 0 {
+			steps[i].ConversionRate = float64(reached[i]) / float64(reached[0])
+		}
+		if i > 0 {
+			steps[i].DropOff = reached[i-1] - reached[i]
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":           from,
+		"to":             to,
+		"window_seconds": int64(window.Seconds()),
+		"steps":          steps,
+	})
+}
+
+// defaultCohortRanges is how far back cohorts start when from is omitted.
+var defaultCohortRanges = map[string]time.Duration{
+	clickhouse.GranularityDay:   14 * 24 * time.Hour,
+	clickhouse.GranularityWeek:  8 * 7 * 24 * time.Hour,
+	clickhouse.GranularityMonth: 183 * 24 * time.Hour,
+}
+
+// maxCohortPeriods bounds the width of a retention table.
+const maxCohortPeriods = 90
+
+// GetRetention returns a cohort retention table. Users are grouped by the
+// day, week or month of their first cohort_event (any event by default) within
+// from and to, and counted again in each later period in which they did
+// return_event (any event by default).
+func (h *AnalyticsHandler) GetRetention(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", clickhouse.GranularityWeek)
+	if !clickhouse.IsValidGranularity(granularity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be day, week or month"})
+		return
+	}
+
+	periods := 12
+	if v := c.Query("periods"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCohortPeriods {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "periods must be between 1 and " + strconv.Itoa(maxCohortPeriods)})
+			return
+		}
+		periods = n
+	}
+
+	from, to, ok := parseTimeRange(c, defaultCohortRanges[granularity], 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	cohorts, err := h.clickhouse.GetRetentionCohorts(c.Request.Context(), orgID.(uint64), clickhouse.RetentionQuery{
+		Granularity: granularity,
+		CohortEvent: c.Query("cohort_event"),
+		ReturnEvent: c.Query("return_event"),
+		From:        from,
+		To:          to,
+		Periods:     periods,
+	})
+	if err != nil {
+		log.Printf("Error computing retention cohorts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute retention"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from,
+		"to":          to,
+		"granularity": granularity,
+		"cohorts":     cohorts,
+	})
+}
+
+// maxSessionTimeoutMinutes bounds the inactivity gap accepted by the session
+// endpoints.
+const maxSessionTimeoutMinutes = 24 * 60
+
+// parseSessionTimeout reads the timeout_minutes query parameter.
+func parseSessionTimeout(c *gin.Context) (time.Duration, bool) {
+	v := c.Query("timeout_minutes")
+	if v == "" {
+		return clickhouse.DefaultSessionTimeout, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxSessionTimeoutMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout_minutes must be between 1 and " + strconv.Itoa(maxSessionTimeoutMinutes)})
+		return 0, false
+	}
+	return time.Duration(n) * time.Minute, true
+}
+
+// ListSessions returns a user's sessions, defaulting to the caller and the
+// last 7 days.
+func (h *AnalyticsHandler) ListSessions(c *gin.Context) {
+	uid, ok := queryUserID(c)
+	if !ok {
+		return
+	}
+	timeout, ok := parseSessionTimeout(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	sessions, err := h.clickhouse.GetUserAnalyticsSessions(c.Request.Context(), orgID.(uint64), uid, timeout, from, to)
+	if err != nil {
+		log.Printf("Error fetching analytics sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "sessions": sessions})
+}
+
+// GetSessionSummary returns session metrics for the caller's organization,
+// defaulting to the last 7 days.
+func (h *AnalyticsHandler) GetSessionSummary(c *gin.Context) {
+	timeout, ok := parseSessionTimeout(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	summary, err := h.clickhouse.GetSessionSummary(c.Request.Context(), orgID.(uint64), timeout, from, to)
+	if err != nil {
+		log.Printf("Error fetching session summary: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "summary": summary})
+}
+
+// GetSessionTimeline replays the events of one session in order. The same
+// timeout_minutes used to list the session must be passed.
+func (h *AnalyticsHandler) GetSessionTimeline(c *gin.Context) {
+	timeout, ok := parseSessionTimeout(c)
+	if !ok {
+		return
+	}
+	orgID, _ := c.Get("orgID")
+
+	events, err := h.clickhouse.GetSessionTimeline(c.Request.Context(), orgID.(uint64), c.Param("sessionID"), timeout)
+	if errors.Is(err, clickhouse.ErrInvalidSessionID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching session timeline: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session timeline"})
+		return
+	}
+	if len(events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("sessionID"), "events": events})
+}
+
+// maxPropertyValues bounds the values returned by GetPropertyValues.
+const maxPropertyValues = 1000
+
+// GetPropertyStats returns count, sum, average, extremes and percentiles of a
+// numeric property, optionally for one event, defaulting to the last 24
+// hours. Events where the property is missing or not a number are skipped.
+func (h *AnalyticsHandler) GetPropertyStats(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	stats, err := h.clickhouse.GetPropertyStats(c.Request.Context(), orgID.(uint64), c.Query("event"), c.Param("key"), from, to)
+	if err != nil {
+		log.Printf("Error fetching property stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch property stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetPropertyValues returns the most common values of a property with their
+// types and counts, optionally for one event, defaulting to the last 24 hours.
+func (h *AnalyticsHandler) GetPropertyValues(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour, time.Hour)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPropertyValues {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPropertyValues)})
+			return
+		}
+		limit = n
+	}
+
+	orgID, _ := c.Get("orgID")
+	values, err := h.clickhouse.GetPropertyValues(c.Request.Context(), orgID.(uint64), c.Query("event"), c.Param("key"), from, to, limit)
+	if err != nil {
+		log.Printf("Error fetching property values: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch property values"})
+		return
+	}
+
+	c.JSON(http.StatusOK, values)
+}
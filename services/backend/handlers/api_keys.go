@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type APIKeyHandler struct {
+	db        *database.Database
+	publisher *events.Publisher
+}
+
+func NewAPIKeyHandler(db *database.Database, publisher *events.Publisher) *APIKeyHandler {
+	return &APIKeyHandler{
+		db:        db,
+		publisher: publisher,
+	}
+}
+
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	keys, err := models.GetUserAPIKeys(c.Request.Context(), h.db.Pool, uint(userID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching API keys"})
+		return
+	}
+
+	if keys == nil {
+		keys = []models.APIKey{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateKey issues a key scoped to a subset of the caller's permissions in the
+// current organization. The plaintext key is only returned in this response.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	if _, usingKey := c.Get("apiKeyID"); usingKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create other API keys"})
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	permissions, _ := c.Get("permissions")
+	granted := map[string]bool{}
+	for _, p := range permissions.([]string) {
+		granted[p] = true
+	}
+	for _, scope := range req.Scopes {
+		if !granted[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope not granted to your role: " + scope})
+			return
+		}
+	}
+
+	rawKey, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating API key"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+	key := models.APIKey{
+		UserID: uint(userID.(uint64)),
+		OrgID:  uint(orgID.(uint64)),
+		Name:   req.Name,
+		Prefix: prefix,
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := models.CreateAPIKey(c.Request.Context(), h.db.Pool, &key, hash); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating API key"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionCreate, models.ResourceAPIKey, strconv.FormatUint(uint64(key.ID), 10), map[string]interface{}{
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"key": rawKey, "api_key": key})
+}
+
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	if err := models.RevokeAPIKey(c.Request.Context(), h.db.Pool, uint(userID.(uint64)), uint(keyID)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		log.Printf("Error revoking API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking API key"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionRevoke, models.ResourceAPIKey, strconv.FormatUint(keyID, 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
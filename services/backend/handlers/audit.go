@@ -39,8 +39,10 @@ func (h *AuditHandler) GetLogs(c *gin.Context) {
 		return
 	}
 
-	// Get logs from ClickHouse
-	logs, err := h.clickhouse.GetAuditLogs(c.Request.Context(), uid)
+	orgID, _ := c.Get("orgID")
+
+	// Get logs from ClickHouse, scoped to the caller's organization
+	logs, err := h.clickhouse.GetAuditLogs(c.Request.Context(), orgID.(uint64), uid)
 	if err != nil {
 		log.Printf("Error fetching audit logs: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs", "details": err.Error()})
@@ -1,26 +1,39 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"go-turbo/pkg/auth"
 	"go-turbo/pkg/database"
 	"go-turbo/pkg/events"
+	"go-turbo/pkg/mailer"
 	"go-turbo/pkg/models"
+	"go-turbo/pkg/password"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 )
 
 type AuthHandler struct {
-	db        *database.Database
-	publisher *events.Publisher
+	db             *database.Database
+	publisher      *events.Publisher
+	mailer         mailer.Mailer
+	passwordPolicy *password.Policy
+	appURL         string
 }
 
-func NewAuthHandler(db *database.Database, publisher *events.Publisher) *AuthHandler {
+func NewAuthHandler(db *database.Database, publisher *events.Publisher, mailer mailer.Mailer, passwordPolicy *password.Policy, appURL string) *AuthHandler {
 	return &AuthHandler{
-		db:        db,
-		publisher: publisher,
+		db:             db,
+		publisher:      publisher,
+		mailer:         mailer,
+		passwordPolicy: passwordPolicy,
+		appURL:         appURL,
 	}
 }
 
@@ -28,6 +41,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var loginReq struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		OrgID    uint   `json:"org_id"`
 	}
 
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
@@ -35,10 +49,19 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	accountKey := accountThrottleKey(loginReq.Email)
+	ipKey := c.ClientIP()
+	if wait := h.loginRetryAfter(c.Request.Context(), accountKey, ipKey); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
 	user, err := models.ValidateUserCredentials(c.Request.Context(), h.db.Pool, loginReq.Email, loginReq.Password)
 	if err != nil {
+		h.recordLoginFailure(c, accountKey, ipKey)
+
 		// Track failed login attempt
-		h.publisher.TrackLogin(c.Request.Context(), 0, false, map[string]string{
+		h.publisher.TrackLogin(c.Request.Context(), 0, false, models.Properties{
 			"email": loginReq.Email,
 			"error": err.Error(),
 		})
@@ -47,36 +70,105 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := auth.GenerateJWT(*user)
+	if err := models.ClearLoginThrottle(c.Request.Context(), h.db.Pool, models.ThrottleScopeAccount, accountKey); err != nil {
+		log.Printf("Error clearing login throttle: %v", err)
+	}
+
+	if user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	orgID := loginReq.OrgID
+	if orgID == 0 {
+		orgID, err = models.GetDefaultOrganizationID(c.Request.Context(), h.db.Pool, user.ID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to any organization"})
+			return
+		}
+	} else if _, err := models.GetMembership(c.Request.Context(), h.db.Pool, orgID, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+		return
+	}
+
+	h.startSession(c, user, orgID)
+}
+
+// startSession finishes a successful first-factor login. Users with 2FA get a
+// challenge token and finish at /api/auth/2fa/verify.
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, orgID uint) {
+	if user.TOTPEnabled {
+		challenge, err := auth.GenerateChallengeToken(*user, orgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "challenge_token": challenge})
+		return
+	}
+
+	h.completeLogin(c, user, orgID, false)
+}
+
+// completeLogin starts a session, issues its token and records the successful login.
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User, orgID uint, mfa bool) {
+	session := models.Session{
+		UserID:    user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: time.Now().Add(auth.TokenTTL),
+	}
+	if err := models.CreateSession(c.Request.Context(), h.db.Pool, &session); err != nil {
+		log.Printf("Error creating session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	token, err := issueToken(c.Request.Context(), h.db, *user, orgID, mfa, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
+	c.Request = c.Request.WithContext(events.WithOrgID(c.Request.Context(), uint64(orgID)))
+
 	// Track successful login
-	h.publisher.TrackLogin(c.Request.Context(), uint64(user.ID), true, map[string]string{
+	h.publisher.TrackLogin(c.Request.Context(), uint64(user.ID), true, models.Properties{
 		"email": user.Email,
 		"role":  user.Role,
+		"mfa":   mfa,
 	})
 
 	// Log audit event
 	h.publisher.LogUserAction(c.Request.Context(), uint64(user.ID), models.ActionLogin, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
-		"email": user.Email,
-		"role":  user.Role,
+		"email":      user.Email,
+		"role":       user.Role,
+		"mfa":        mfa,
+		"session_id": session.ID,
 	})
 
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
+// registerRequest is everything a client may set when registering. The role
+// is always assigned by the server.
+type registerRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req registerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	if user.Role == "" {
-		user.Role = "user" // Default role
+	user := models.User{Email: req.Email, Password: req.Password, Role: "user"}
+
+	if err := h.passwordPolicy.Check(user.Password, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if err := models.CreateUser(c.Request.Context(), h.db.Pool, &user); err != nil {
@@ -84,8 +176,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Every new user starts with a personal organization
+	org := models.Organization{Name: user.Email}
+	if err := models.CreateOrganization(c.Request.Context(), h.db.Pool, &org, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating organization"})
+		return
+	}
+	c.Request = c.Request.WithContext(events.WithOrgID(c.Request.Context(), uint64(org.ID)))
+
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+
 	// Track registration
-	h.publisher.TrackRegistration(c.Request.Context(), uint64(user.ID), map[string]string{
+	h.publisher.TrackRegistration(c.Request.Context(), uint64(user.ID), models.Properties{
 		"email": user.Email,
 		"role":  user.Role,
 	})
@@ -96,11 +200,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		"role":  user.Role,
 	})
 
+	user.Password = "" // Don't send password back
 	c.JSON(http.StatusCreated, user)
 }
 
 func (h *AuthHandler) GetUsers(c *gin.Context) {
-	users, err := models.GetAllUsers(c.Request.Context(), h.db.Pool)
+	orgID, _ := c.Get("orgID")
+	users, err := models.GetOrganizationUsers(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
 		return
@@ -133,3 +239,37 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 	}
 }
+
+// issueToken signs a JWT for the session in the given organization with the
+// permissions and 2FA requirement currently configured for the user's role in
+// that organization.
+func issueToken(ctx context.Context, db *database.Database, user models.User, orgID uint, mfa bool, sessionID string) (string, error) {
+	opts := auth.TokenOptions{SessionID: sessionID, OrgID: orgID, MFA: mfa}
+
+	member, err := models.GetMembership(ctx, db.Pool, orgID, user.ID)
+	if err != nil {
+		return "", err
+	}
+	user.Role = models.MemberRole(member.Role)
+
+	role, err := models.GetRoleByName(ctx, db.Pool, user.Role)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	if role != nil {
+		opts.Permissions = role.Permissions
+		opts.MFARequired = role.Require2FA
+	}
+
+	return auth.GenerateJWT(user, opts)
+}
+
+// reissueToken replaces the caller's token within their current session, for
+// example after switching organization, and extends the session to match.
+func reissueToken(c *gin.Context, db *database.Database, user models.User, orgID uint, mfa bool) (string, error) {
+	sessionID := c.GetString("sessionID")
+	if err := models.ExtendSession(c.Request.Context(), db.Pool, sessionID, time.Now().Add(auth.TokenTTL)); err != nil {
+		return "", err
+	}
+	return issueToken(c.Request.Context(), db, user, orgID, mfa, sessionID)
+}
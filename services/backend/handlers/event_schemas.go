@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/database/clickhouse"
+	"go-turbo/pkg/eventschema"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxQuarantinedEvents bounds the quarantined events returned at once.
+const maxQuarantinedEvents = 1000
+
+type EventSchemaHandler struct {
+	db         *database.Database
+	clickhouse *clickhouse.Client
+	publisher  *events.Publisher
+}
+
+func NewEventSchemaHandler(db *database.Database, clickhouseClient *clickhouse.Client, publisher *events.Publisher) *EventSchemaHandler {
+	return &EventSchemaHandler{
+		db:         db,
+		clickhouse: clickhouseClient,
+		publisher:  publisher,
+	}
+}
+
+type eventSchemaRequest struct {
+	Description               string                           `json:"description"`
+	Properties                map[string]models.PropertySchema `json:"properties"`
+	AllowAdditionalProperties *bool                            `json:"allow_additional_properties"`
+}
+
+func (h *EventSchemaHandler) ListSchemas(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+	schemas, err := models.GetEventSchemas(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching event schemas: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event schemas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas)
+}
+
+func (h *EventSchemaHandler) GetSchema(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+	schema, err := models.GetEventSchema(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), c.Param("event"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event schema not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching event schema: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event schema"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// PutSchema registers the :event name with the given property schemas,
+// replacing any existing schema. Additional properties are allowed unless
+// allow_additional_properties is false.
+func (h *EventSchemaHandler) PutSchema(c *gin.Context) {
+	var req eventSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+	createdBy := uint(userID.(uint64))
+	schema := models.EventSchema{
+		OrgID:                     uint(orgID.(uint64)),
+		EventName:                 c.Param("event"),
+		Description:               req.Description,
+		Properties:                req.Properties,
+		AllowAdditionalProperties: req.AllowAdditionalProperties == nil || *req.AllowAdditionalProperties,
+		CreatedBy:                 &createdBy,
+	}
+	if schema.Properties == nil {
+		schema.Properties = map[string]models.PropertySchema{}
+	}
+	if err := eventschema.CheckSchema(&schema); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SaveEventSchema(c.Request.Context(), h.db.Pool, &schema); err != nil {
+		log.Printf("Error saving event schema: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving event schema"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionUpdate, models.ResourceEventSchema, schema.EventName, map[string]interface{}{
+		"properties":                  schema.Properties,
+		"allow_additional_properties": schema.AllowAdditionalProperties,
+	})
+
+	c.JSON(http.StatusOK, schema)
+}
+
+func (h *EventSchemaHandler) DeleteSchema(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+	eventName := c.Param("event")
+	if err := models.DeleteEventSchema(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), eventName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event schema not found"})
+			return
+		}
+		log.Printf("Error deleting event schema: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting event schema"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionDelete, models.ResourceEventSchema, eventName, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *EventSchemaHandler) GetValidationMode(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+	mode, err := models.GetEventValidationMode(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching event validation mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event validation mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": mode})
+}
+
+// SetValidationMode switches the organization between off, reject and
+// quarantine. Ingest picks up the change within 30 seconds.
+func (h *EventSchemaHandler) SetValidationMode(c *gin.Context) {
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if !models.IsValidEventValidationMode(req.Mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be off, reject or quarantine"})
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	if err := models.SetEventValidationMode(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), req.Mode); err != nil {
+		log.Printf("Error updating event validation mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating event validation mode"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionUpdate, models.ResourceOrg, strconv.FormatUint(orgID.(uint64), 10), map[string]interface{}{
+		"event_validation": req.Mode,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"mode": req.Mode})
+}
+
+// ListQuarantine returns recently quarantined events with the reasons they
+// failed validation, optionally for one event name.
+func (h *EventSchemaHandler) ListQuarantine(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour, time.Second)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQuarantinedEvents {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxQuarantinedEvents)})
+			return
+		}
+		limit = n
+	}
+
+	orgID, _ := c.Get("orgID")
+	quarantined, err := h.clickhouse.GetQuarantinedEvents(c.Request.Context(), orgID.(uint64), c.Query("event"), from, to, limit)
+	if err != nil {
+		log.Printf("Error fetching quarantined events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching quarantined events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quarantined)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accountThrottleKey normalizes an email so attempts with different casing share a counter.
+func accountThrottleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginRetryAfter returns how long the client must wait before another login
+// attempt for this account or from this IP is accepted.
+func (h *AuthHandler) loginRetryAfter(ctx context.Context, accountKey, ipKey string) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+
+	checks := []struct {
+		scope  string
+		key    string
+		policy auth.LockoutPolicy
+	}{
+		{models.ThrottleScopeAccount, accountKey, auth.AccountLockoutPolicy},
+		{models.ThrottleScopeIP, ipKey, auth.IPLockoutPolicy},
+	}
+	for _, check := range checks {
+		throttle, err := models.GetLoginThrottle(ctx, h.db.Pool, check.scope, check.key)
+		if err != nil {
+			log.Printf("Error loading login throttle: %v", err)
+			continue
+		}
+		if throttle == nil {
+			continue
+		}
+		if w := check.policy.RetryAfter(throttle.Failures, throttle.LastFailedAt, throttle.LockedUntil, now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// recordLoginFailure bumps the account and IP counters and emits a security
+// audit event when either of them becomes locked.
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, accountKey, ipKey string) {
+	ctx := c.Request.Context()
+
+	throttle, locked, err := models.RecordLoginFailure(ctx, h.db.Pool, models.ThrottleScopeAccount, accountKey,
+		auth.AccountLockoutPolicy.Window, auth.AccountLockoutPolicy.LockAfter, auth.AccountLockoutPolicy.LockDuration)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	} else if locked {
+		var userID uint64
+		resourceID := accountKey
+		if user, err := models.GetUserByEmail(ctx, h.db.Pool, accountKey); err == nil {
+			userID = uint64(user.ID)
+			resourceID = strconv.FormatUint(userID, 10)
+			ctx = h.userOrgContext(ctx, user.ID)
+		}
+		h.publisher.LogUserAction(ctx, userID, models.ActionLockout, models.ResourceUser, resourceID, map[string]interface{}{
+			"email":        accountKey,
+			"failures":     throttle.Failures,
+			"locked_until": throttle.LockedUntil,
+			"ip_address":   ipKey,
+		})
+	}
+
+	throttle, locked, err = models.RecordLoginFailure(c.Request.Context(), h.db.Pool, models.ThrottleScopeIP, ipKey,
+		auth.IPLockoutPolicy.Window, auth.IPLockoutPolicy.LockAfter, auth.IPLockoutPolicy.LockDuration)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	} else if locked {
+		h.publisher.LogUserAction(c.Request.Context(), 0, models.ActionLockout, models.ResourceIPAddress, ipKey, map[string]interface{}{
+			"failures":     throttle.Failures,
+			"locked_until": throttle.LockedUntil,
+			"user_agent":   c.Request.UserAgent(),
+		})
+	}
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+}
+
+// UnlockUser clears the failed-login counter and any lockout for an account.
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	targetID, ok := h.orgUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), h.db.Pool, targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := models.ClearLoginThrottle(c.Request.Context(), h.db.Pool, models.ThrottleScopeAccount, accountThrottleKey(user.Email)); err != nil {
+		log.Printf("Error clearing login throttle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unlocking user"})
+		return
+	}
+
+	if id, exists := c.Get("userID"); exists {
+		h.publisher.LogUserAction(c.Request.Context(), id.(uint64), models.ActionUnlock, models.ResourceUser, strconv.FormatUint(uint64(targetID), 10), map[string]interface{}{
+			"email": user.Email,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
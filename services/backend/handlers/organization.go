@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+type OrganizationHandler struct {
+	db        *database.Database
+	publisher *events.Publisher
+	mailer    mailer.Mailer
+	appURL    string
+}
+
+func NewOrganizationHandler(db *database.Database, publisher *events.Publisher, m mailer.Mailer, appURL string) *OrganizationHandler {
+	return &OrganizationHandler{
+		db:        db,
+		publisher: publisher,
+		mailer:    m,
+		appURL:    appURL,
+	}
+}
+
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgs, err := models.GetUserOrganizations(c.Request.Context(), h.db.Pool, uint(userID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching organizations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching organizations"})
+		return
+	}
+
+	if orgs == nil {
+		orgs = []models.Organization{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	org := models.Organization{Name: req.Name}
+	if err := models.CreateOrganization(c.Request.Context(), h.db.Pool, &org, uint(userID.(uint64))); err != nil {
+		log.Printf("Error creating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating organization"})
+		return
+	}
+
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), uint64(org.ID)), userID.(uint64), models.ActionCreate, models.ResourceOrg, strconv.FormatUint(uint64(org.ID), 10), map[string]interface{}{
+		"name": org.Name,
+	})
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// SwitchOrganization issues a new token scoped to another organization the caller belongs to.
+func (h *OrganizationHandler) SwitchOrganization(c *gin.Context) {
+	orgID, ok := h.memberOrgID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := models.GetUserByID(c.Request.Context(), h.db.Pool, uint(userID.(uint64)))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	token, err := reissueToken(c, h.db, *user, orgID, c.GetBool("mfa"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	orgID, ok := h.memberOrgID(c)
+	if !ok {
+		return
+	}
+
+	members, err := models.GetOrganizationMembers(c.Request.Context(), h.db.Pool, orgID)
+	if err != nil {
+		log.Printf("Error fetching organization members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching members"})
+		return
+	}
+
+	if members == nil {
+		members = []models.OrganizationMember{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// InviteMember invites a user by email. Users join only by accepting, so an
+// owner cannot add someone to their organization without consent. The
+// response is the same whether or not the email belongs to an account.
+func (h *OrganizationHandler) InviteMember(c *gin.Context) {
+	orgID, ok := h.ownerOrgID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if !validOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member role"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := models.GetUserByEmail(ctx, h.db.Pool, req.Email)
+	if err != nil {
+		c.JSON(http.StatusAccepted, gin.H{"status": "invited"})
+		return
+	}
+	if _, err := models.GetMembership(ctx, h.db.Pool, orgID, user.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	inviterID := uint(userID.(uint64))
+	inv := models.OrganizationInvitation{
+		OrganizationID: orgID,
+		UserID:         user.ID,
+		Role:           req.Role,
+		InvitedBy:      &inviterID,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if err := models.CreateOrganizationInvitation(ctx, h.db.Pool, &inv); err != nil {
+		log.Printf("Error creating organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error inviting member"})
+		return
+	}
+
+	if err := h.sendInvitationEmail(ctx, orgID, user.Email); err != nil {
+		log.Printf("Error sending invitation email: %v", err)
+	}
+
+	h.publisher.LogUserAction(events.WithOrgID(ctx, uint64(orgID)), userID.(uint64), models.ActionInvite, models.ResourceOrg, strconv.FormatUint(uint64(orgID), 10), map[string]interface{}{
+		"invited_user_id": user.ID,
+		"role":            req.Role,
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "invited"})
+}
+
+func (h *OrganizationHandler) sendInvitationEmail(ctx context.Context, orgID uint, email string) error {
+	org, err := models.GetOrganizationByID(ctx, h.db.Pool, orgID)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "You have been invited to " + org.Name,
+		Body:    fmt.Sprintf("You have been invited to join %s. Review the invitation here:\n\n%s\n\nThe invitation expires in 7 days. If you do not want to join, ignore this email.\n", org.Name, h.appURL+"/invitations"),
+	})
+}
+
+// ListInvitations lists the organization's pending invitations (owners only).
+func (h *OrganizationHandler) ListInvitations(c *gin.Context) {
+	orgID, ok := h.ownerOrgID(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := models.GetOrganizationInvitations(c.Request.Context(), h.db.Pool, orgID)
+	if err != nil {
+		log.Printf("Error fetching organization invitations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CancelInvitation withdraws a pending invitation (owners only).
+func (h *OrganizationHandler) CancelInvitation(c *gin.Context) {
+	orgID, ok := h.ownerOrgID(c)
+	if !ok {
+		return
+	}
+
+	inviteeID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := models.DeleteOrganizationInvitation(c.Request.Context(), h.db.Pool, orgID, uint(inviteeID)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		log.Printf("Error cancelling organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling invitation"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), uint64(orgID)), userID.(uint64), models.ActionRevoke, models.ResourceOrg, strconv.FormatUint(uint64(orgID), 10), map[string]interface{}{
+		"invited_user_id": inviteeID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// UpdateMember changes an existing member's role (owners only).
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	orgID, ok := h.ownerOrgID(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member role"})
+		return
+	}
+
+	if err := models.UpdateOrganizationMemberRole(c.Request.Context(), h.db.Pool, orgID, uint(memberID), req.Role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		log.Printf("Error updating organization member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating member"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), uint64(orgID)), userID.(uint64), models.ActionUpdate, models.ResourceOrg, strconv.FormatUint(uint64(orgID), 10), map[string]interface{}{
+		"member_user_id": memberID,
+		"role":           req.Role,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// ListMyInvitations lists the caller's pending invitations.
+func (h *OrganizationHandler) ListMyInvitations(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	invitations, err := models.GetUserInvitations(c.Request.Context(), h.db.Pool, uint(userID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching invitations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitation makes the caller a member of the inviting organization.
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	role, err := models.AcceptOrganizationInvitation(c.Request.Context(), h.db.Pool, uint(orgID), uint(userID.(uint64)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or expired"})
+			return
+		}
+		log.Printf("Error accepting organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error accepting invitation"})
+		return
+	}
+
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), orgID), userID.(uint64), models.ActionAcceptInvitation, models.ResourceOrg, strconv.FormatUint(orgID, 10), map[string]interface{}{
+		"role": role,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "organization_id": orgID, "role": role})
+}
+
+// DeclineInvitation discards an invitation to the caller.
+func (h *OrganizationHandler) DeclineInvitation(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	if err := models.DeleteOrganizationInvitation(c.Request.Context(), h.db.Pool, uint(orgID), uint(userID.(uint64))); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		log.Printf("Error declining organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error declining invitation"})
+		return
+	}
+
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), orgID), userID.(uint64), models.ActionDeclineInvitation, models.ResourceOrg, strconv.FormatUint(orgID, 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func validOrgRole(role string) bool {
+	return role == models.OrgRoleMember || role == models.OrgRoleOwner
+}
+
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	orgID, ok := h.ownerOrgID(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := models.RemoveUserFromOrganization(c.Request.Context(), h.db.Pool, orgID, uint(memberID)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		log.Printf("Error removing organization member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing member"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(events.WithOrgID(c.Request.Context(), uint64(orgID)), userID.(uint64), models.ActionUpdate, models.ResourceOrg, strconv.FormatUint(uint64(orgID), 10), map[string]interface{}{
+		"removed_user_id": memberID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// memberOrgID parses the :id route param and checks the caller belongs to that organization.
+func (h *OrganizationHandler) memberOrgID(c *gin.Context) (uint, bool) {
+	member, ok := h.membership(c)
+	if !ok {
+		return 0, false
+	}
+	return member.OrganizationID, true
+}
+
+// ownerOrgID is like memberOrgID but requires the caller to own the organization.
+func (h *OrganizationHandler) ownerOrgID(c *gin.Context) (uint, bool) {
+	member, ok := h.membership(c)
+	if !ok {
+		return 0, false
+	}
+	if member.Role != models.OrgRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization owners can manage members"})
+		return 0, false
+	}
+	return member.OrganizationID, true
+}
+
+func (h *OrganizationHandler) membership(c *gin.Context) (*models.OrganizationMember, bool) {
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("userID")
+	member, err := models.GetMembership(c.Request.Context(), h.db.Pool, uint(orgID), uint(userID.(uint64)))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+		return nil, false
+	}
+	return member, true
+}
@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/database/clickhouse"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	dataExportTTL  = 7 * 24 * time.Hour
+	dataJobTimeout = 30 * time.Minute
+)
+
+// PrivacyHandler runs GDPR data exports and erasures. Both run in the
+// background and are tracked as data requests.
+type PrivacyHandler struct {
+	auth       *AuthHandler
+	clickhouse *clickhouse.Client
+	exportDir  string
+}
+
+func NewPrivacyHandler(authHandler *AuthHandler, clickhouse *clickhouse.Client, exportDir string) *PrivacyHandler {
+	return &PrivacyHandler{
+		auth:       authHandler,
+		clickhouse: clickhouse,
+		exportDir:  exportDir,
+	}
+}
+
+// RequestExport starts building a zip of everything stored about the caller.
+func (h *PrivacyHandler) RequestExport(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	req := models.DataRequest{
+		UserID:      uint(userID.(uint64)),
+		RequestedBy: uint(userID.(uint64)),
+		Kind:        models.DataRequestExport,
+	}
+	if err := models.CreateDataRequest(c.Request.Context(), h.auth.db.Pool, &req); err != nil {
+		log.Printf("Error creating data export request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting export"})
+		return
+	}
+
+	h.auth.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionExport, models.ResourceUser, strconv.FormatUint(userID.(uint64), 10), map[string]interface{}{
+		"request_id": req.ID,
+	})
+
+	go h.runExport(h.jobContext(c), req)
+
+	c.JSON(http.StatusAccepted, req)
+}
+
+func (h *PrivacyHandler) ListExports(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	reqs, err := models.GetUserDataRequests(c.Request.Context(), h.auth.db.Pool, uint(userID.(uint64)), models.DataRequestExport)
+	if err != nil {
+		log.Printf("Error fetching data exports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching exports"})
+		return
+	}
+
+	if reqs == nil {
+		reqs = []models.DataRequest{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, reqs)
+}
+
+func (h *PrivacyHandler) DownloadExport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	req, err := models.GetDataRequest(c.Request.Context(), h.auth.db.Pool, uint(id))
+	if err != nil || req.UserID != uint(userID.(uint64)) || req.Kind != models.DataRequestExport {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if req.Status == models.DataRequestExpired || (req.ExpiresAt != nil && time.Now().After(*req.ExpiresAt)) {
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired"})
+		return
+	}
+	if req.Status != models.DataRequestCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": req.Status})
+		return
+	}
+
+	c.FileAttachment(req.FilePath, fmt.Sprintf("data-export-%d.zip", req.ID))
+}
+
+// RequestErasure deletes the caller's account after re-authentication. Their
+// sessions end immediately; the data is removed in the background.
+func (h *PrivacyHandler) RequestErasure(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.auth.reauthenticate(c, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	h.startErasure(c, user.ID, nil)
+}
+
+// EraseUser removes a user from the admin's organization and erases their
+// data there. The account and the user's other organizations are untouched:
+// only the user or a platform operator can delete the whole account.
+func (h *PrivacyHandler) EraseUser(c *gin.Context) {
+	targetID, ok := h.auth.orgUserID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	org := uint(orgID.(uint64))
+	h.startErasure(c, targetID, &org)
+}
+
+// EraseAccount deletes any account and all of its data. It is reserved for
+// platform operators.
+func (h *PrivacyHandler) EraseAccount(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	h.startErasure(c, uint(targetID), nil)
+}
+
+// GetDataRequest returns the status of a request the caller made.
+func (h *PrivacyHandler) GetDataRequest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	req, err := models.GetDataRequest(c.Request.Context(), h.auth.db.Pool, uint(id))
+	if err != nil || req.RequestedBy != uint(userID.(uint64)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// startErasure queues the erasure of the user's data in orgID, or of the
+// whole account when orgID is nil.
+func (h *PrivacyHandler) startErasure(c *gin.Context, targetID uint, orgID *uint) {
+	ctx := c.Request.Context()
+	actorID, _ := c.Get("userID")
+
+	user, err := models.GetUserByID(ctx, h.auth.db.Pool, targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	req := models.DataRequest{
+		UserID:      targetID,
+		OrgID:       orgID,
+		RequestedBy: uint(actorID.(uint64)),
+		Kind:        models.DataRequestErasure,
+	}
+	if orgID != nil {
+		req.Kind = models.DataRequestOrgErasure
+	}
+	if err := models.CreateDataRequest(ctx, h.auth.db.Pool, &req); err != nil {
+		log.Printf("Error creating erasure request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting erasure"})
+		return
+	}
+
+	// Deleting the account signs it out everywhere
+	if orgID == nil {
+		if _, err := models.RevokeUserSessions(ctx, h.auth.db.Pool, targetID, ""); err != nil {
+			log.Printf("Error revoking sessions: %v", err)
+		}
+	}
+
+	go h.runErasure(h.jobContext(c), req, user.Email)
+
+	c.JSON(http.StatusAccepted, req)
+}
+
+// jobContext detaches a background job from the request while keeping the
+// organization used to stamp its events.
+func (h *PrivacyHandler) jobContext(c *gin.Context) context.Context {
+	return events.WithOrgID(context.Background(), events.OrgIDFromContext(c.Request.Context()))
+}
+
+func (h *PrivacyHandler) runExport(ctx context.Context, req models.DataRequest) {
+	ctx, cancel := context.WithTimeout(ctx, dataJobTimeout)
+	defer cancel()
+
+	pool := h.auth.db.Pool
+	if err := models.StartDataRequest(ctx, pool, req.ID); err != nil {
+		log.Printf("Error starting data export %d: %v", req.ID, err)
+	}
+
+	path, err := h.writeExport(ctx, req)
+	if err != nil {
+		log.Printf("Error building data export %d: %v", req.ID, err)
+		if err := models.FailDataRequest(ctx, pool, req.ID, "export failed"); err != nil {
+			log.Printf("Error marking data export %d failed: %v", req.ID, err)
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(dataExportTTL)
+	if err := models.CompleteDataRequest(ctx, pool, req.ID, path, &expiresAt); err != nil {
+		log.Printf("Error completing data export %d: %v", req.ID, err)
+	}
+}
+
+// writeExport writes profile.json, analytics_events.json and audit_logs.json
+// into a zip and returns its path.
+func (h *PrivacyHandler) writeExport(ctx context.Context, req models.DataRequest) (string, error) {
+	if err := os.MkdirAll(h.exportDir, 0o700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(h.exportDir, fmt.Sprintf("export-%d.zip", req.ID))
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	profile, err := h.collectProfile(ctx, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	w, err := zw.Create("profile.json")
+	if err != nil {
+		return "", err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(profile); err != nil {
+		return "", err
+	}
+
+	w, err = zw.Create("analytics_events.json")
+	if err != nil {
+		return "", err
+	}
+	array := newJSONArrayWriter(w)
+	err = h.clickhouse.StreamUserAnalyticsEvents(ctx, uint64(req.UserID), func(event models.AnalyticsEvent) error {
+		return array.Write(event)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := array.Close(); err != nil {
+		return "", err
+	}
+
+	w, err = zw.Create("audit_logs.json")
+	if err != nil {
+		return "", err
+	}
+	array = newJSONArrayWriter(w)
+	err = h.clickhouse.StreamUserAuditLogs(ctx, uint64(req.UserID), func(log models.AuditLog) error {
+		return array.Write(log)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := array.Close(); err != nil {
+		return "", err
+	}
+
+	w, err = zw.Create("quarantined_events.json")
+	if err != nil {
+		return "", err
+	}
+	array = newJSONArrayWriter(w)
+	err = h.clickhouse.StreamUserQuarantinedEvents(ctx, uint64(req.UserID), func(q clickhouse.QuarantinedEvent) error {
+		return array.Write(q)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := array.Close(); err != nil {
+		return "", err
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmpPath, path)
+}
+
+// DeleteExpiredExports deletes export files past their download window and
+// marks their requests expired, returning how many were removed.
+func (h *PrivacyHandler) DeleteExpiredExports(ctx context.Context) (int, error) {
+	reqs, err := models.GetExpiredExports(ctx, h.auth.db.Pool, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for i, req := range reqs {
+		if req.FilePath != "" {
+			if err := os.Remove(req.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return i, err
+			}
+		}
+		if err := models.ExpireDataRequest(ctx, h.auth.db.Pool, req.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(reqs), nil
+}
+
+// collectProfile gathers everything Postgres holds about the user.
+func (h *PrivacyHandler) collectProfile(ctx context.Context, userID uint) (map[string]interface{}, error) {
+	pool := h.auth.db.Pool
+
+	user, err := models.GetUserByID(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	orgs, err := models.GetUserOrganizations(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := models.GetUserIdentities(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := models.GetUserSessions(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := models.GetUserAPIKeys(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"user":          user,
+		"organizations": orgs,
+		"identities":    identities,
+		"sessions":      sessions,
+		"api_keys":      apiKeys,
+		"exported_at":   time.Now(),
+	}, nil
+}
+
+// runErasure pseudonymizes analytics, redacts audit logs and finally deletes
+// the account, or for an organization erasure removes the user from that
+// organization. ClickHouse goes first so a failure leaves the account in
+// place and the request can be repeated.
+func (h *PrivacyHandler) runErasure(ctx context.Context, req models.DataRequest, email string) {
+	ctx, cancel := context.WithTimeout(ctx, dataJobTimeout)
+	defer cancel()
+
+	pool := h.auth.db.Pool
+	if err := models.StartDataRequest(ctx, pool, req.ID); err != nil {
+		log.Printf("Error starting erasure %d: %v", req.ID, err)
+	}
+
+	erase := h.erase
+	if req.Kind == models.DataRequestOrgErasure {
+		erase = func(ctx context.Context, userID uint, email string) error {
+			return h.eraseFromOrg(ctx, *req.OrgID, userID, email)
+		}
+	}
+	if err := erase(ctx, req.UserID, email); err != nil {
+		log.Printf("Error erasing user %d: %v", req.UserID, err)
+		if err := models.FailDataRequest(ctx, pool, req.ID, "erasure failed"); err != nil {
+			log.Printf("Error marking erasure %d failed: %v", req.ID, err)
+		}
+		return
+	}
+
+	if err := models.CompleteDataRequest(ctx, pool, req.ID, "", nil); err != nil {
+		log.Printf("Error completing erasure %d: %v", req.ID, err)
+	}
+
+	// The audit entry only carries the numeric ID, never the erased email
+	h.auth.publisher.LogUserAction(ctx, uint64(req.RequestedBy), models.ActionErase, models.ResourceUser, strconv.FormatUint(uint64(req.UserID), 10), map[string]interface{}{
+		"request_id": req.ID,
+	})
+}
+
+func (h *PrivacyHandler) erase(ctx context.Context, userID uint, email string) error {
+	pseudonymID, err := randomPseudonymID()
+	if err != nil {
+		return err
+	}
+	if err := h.clickhouse.PseudonymizeUserAnalytics(ctx, 0, uint64(userID), pseudonymID); err != nil {
+		return err
+	}
+	if err := h.clickhouse.DeleteUserQuarantinedEvents(ctx, 0, uint64(userID)); err != nil {
+		return err
+	}
+	emails, err := h.userEmails(ctx, userID, email)
+	if err != nil {
+		return err
+	}
+	if err := h.clickhouse.RedactUserAuditLogs(ctx, 0, uint64(userID), emails); err != nil {
+		return err
+	}
+
+	// Remove any previous exports of the user's data
+	reqs, err := models.GetUserDataRequests(ctx, h.auth.db.Pool, userID, models.DataRequestExport)
+	if err != nil {
+		return err
+	}
+	for _, r := range reqs {
+		if r.FilePath != "" {
+			if err := os.Remove(r.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	err = models.DeleteUser(ctx, h.auth.db.Pool, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // Already deleted by an earlier attempt
+	}
+	return err
+}
+
+// eraseFromOrg pseudonymizes the user's analytics and redacts audit logs in
+// one organization, then ends their membership there.
+func (h *PrivacyHandler) eraseFromOrg(ctx context.Context, orgID, userID uint, email string) error {
+	pseudonymID, err := randomPseudonymID()
+	if err != nil {
+		return err
+	}
+	if err := h.clickhouse.PseudonymizeUserAnalytics(ctx, uint64(orgID), uint64(userID), pseudonymID); err != nil {
+		return err
+	}
+	if err := h.clickhouse.DeleteUserQuarantinedEvents(ctx, uint64(orgID), uint64(userID)); err != nil {
+		return err
+	}
+	emails, err := h.userEmails(ctx, userID, email)
+	if err != nil {
+		return err
+	}
+	if err := h.clickhouse.RedactUserAuditLogs(ctx, uint64(orgID), uint64(userID), emails); err != nil {
+		return err
+	}
+	err = models.RemoveUserFromOrganization(ctx, h.auth.db.Pool, orgID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // Already removed by an earlier attempt
+	}
+	return err
+}
+
+// userEmails returns the current address together with every address the
+// user has requested or held before, as recorded in the audit history.
+func (h *PrivacyHandler) userEmails(ctx context.Context, userID uint, email string) ([]string, error) {
+	history, err := h.clickhouse.GetUserEmailHistory(ctx, uint64(userID))
+	if err != nil {
+		return nil, err
+	}
+	return append(history, email), nil
+}
+
+// randomPseudonymID returns an unlinkable ID outside the range of real user
+// IDs so pseudonymized rows never collide with an account.
+func randomPseudonymID() (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]) | 1<<63, nil
+}
+
+// jsonArrayWriter streams values as a JSON array without holding them in memory.
+type jsonArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArrayWriter(w io.Writer) *jsonArrayWriter {
+	return &jsonArrayWriter{w: w}
+}
+
+func (a *jsonArrayWriter) Write(v interface{}) error {
+	prefix := ",\n"
+	if a.count == 0 {
+		prefix = "[\n"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(a.w, prefix); err != nil {
+		return err
+	}
+	a.count++
+	_, err = a.w.Write(data)
+	return err
+}
+
+func (a *jsonArrayWriter) Close() error {
+	end := "\n]\n"
+	if a.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
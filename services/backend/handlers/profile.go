@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/password"
+
+	"github.com/gin-gonic/gin"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// UpdateProfile changes profile fields. A new email address only takes effect
+// once the link sent to it is confirmed.
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req struct {
+		Email           *string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.reauthenticate(c, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	newEmail := strings.TrimSpace(*req.Email)
+	if newEmail == "" || !strings.Contains(newEmail, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email address is unchanged"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := models.SetPendingEmail(ctx, h.db.Pool, user.ID, newEmail); err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error storing pending email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile"})
+		return
+	}
+
+	if err := h.sendEmailChangeConfirmation(ctx, user, newEmail); err != nil {
+		log.Printf("Error sending email change confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending confirmation email"})
+		return
+	}
+
+	h.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionRequestEmailChange, models.ResourceProfile, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"changes": map[string]interface{}{
+			"email": fieldChange(user.Email, newEmail),
+		},
+		"ip_address": c.ClientIP(),
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "pending_confirmation", "pending_email": newEmail})
+}
+
+// ConfirmEmailChange applies a pending email change from the emailed token.
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, err := h.consumeToken(c.Request.Context(), auth.TokenPurposeEmailChange, req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	oldEmail, newEmail, err := models.ConfirmPendingEmail(c.Request.Context(), h.db.Pool, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No email change is pending"})
+		default:
+			log.Printf("Error confirming email change: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing email"})
+		}
+		return
+	}
+
+	ctx := h.userOrgContext(c.Request.Context(), userID)
+
+	// Let the previous address know in case the change was not requested by its owner
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body:    fmt.Sprintf("The email address on your account was changed to %s.\n\nIf you did not make this change, reset your password and contact support.\n", newEmail),
+	})
+	if err != nil {
+		log.Printf("Error sending email change notice: %v", err)
+	}
+
+	h.publisher.LogUserAction(ctx, uint64(userID), models.ActionChangeEmail, models.ResourceProfile, strconv.FormatUint(uint64(userID), 10), map[string]interface{}{
+		"changes": map[string]interface{}{
+			"email": fieldChange(oldEmail, newEmail),
+		},
+		"ip_address": c.ClientIP(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "email": newEmail})
+}
+
+// ChangePassword sets a new password after re-authentication. Every other
+// session is signed out; the caller receives a fresh token to keep theirs.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.reauthenticate(c, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current password"})
+		return
+	}
+	if err := h.passwordPolicy.Check(req.NewPassword, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := models.UpdateUserPassword(ctx, h.db.Pool, user.ID, req.NewPassword); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing password"})
+		return
+	}
+
+	revoked, err := models.RevokeUserSessions(ctx, h.db.Pool, user.ID, c.GetString("sessionID"))
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+	}
+
+	orgID, _ := c.Get("orgID")
+	user.Password = ""
+	token, err := reissueToken(c, h.db, *user, uint(orgID.(uint64)), c.GetBool("mfa"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "The password on your account was changed and other sessions were signed out.\n\nIf you did not make this change, reset your password immediately.\n",
+	})
+	if err != nil {
+		log.Printf("Error sending password change notice: %v", err)
+	}
+
+	// Password values are never logged, only that the field changed
+	h.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionChangePassword, models.ResourceProfile, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"changes": map[string]interface{}{
+			"password": map[string]interface{}{"changed": true},
+		},
+		"sessions_revoked": revoked,
+		"ip_address":       c.ClientIP(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// reauthenticate loads the caller and checks their current password. API keys
+// cannot be used to change credentials.
+func (h *AuthHandler) reauthenticate(c *gin.Context, currentPassword string) (*models.User, bool) {
+	if _, usingKey := c.Get("apiKeyID"); usingKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot change account credentials"})
+		return nil, false
+	}
+	if currentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is required"})
+		return nil, false
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	match, _, err := password.Verify(currentPassword, user.Password)
+	if err != nil || !match {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *AuthHandler) sendEmailChangeConfirmation(ctx context.Context, user *models.User, newEmail string) error {
+	link, err := h.issueActionLink(ctx, user.ID, auth.TokenPurposeEmailChange, emailChangeTTL, "/confirm-email-change")
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body:    fmt.Sprintf("Confirm %s as the email address for your account by opening the link below:\n\n%s\n\nThe link expires in 24 hours.\n", newEmail, link),
+	})
+}
+
+func fieldChange(oldValue, newValue interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"old": oldValue,
+		"new": newValue,
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type RBACHandler struct {
+	db        *database.Database
+	publisher *events.Publisher
+}
+
+func NewRBACHandler(db *database.Database, publisher *events.Publisher) *RBACHandler {
+	return &RBACHandler{
+		db:        db,
+		publisher: publisher,
+	}
+}
+
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Require2FA  bool     `json:"require_2fa"`
+}
+
+func (h *RBACHandler) ListRoles(c *gin.Context) {
+	roles, err := models.GetAllRoles(c.Request.Context(), h.db.Pool)
+	if err != nil {
+		log.Printf("Error fetching roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+		return
+	}
+
+	if roles == nil {
+		roles = []models.Role{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *RBACHandler) GetRole(c *gin.Context) {
+	role, err := models.GetRoleByName(c.Request.Context(), h.db.Pool, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RBACHandler) ListPermissions(c *gin.Context) {
+	permissions, err := models.GetAllPermissions(c.Request.Context(), h.db.Pool)
+	if err != nil {
+		log.Printf("Error fetching permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching permissions"})
+		return
+	}
+
+	if permissions == nil {
+		permissions = []models.Permission{} // Return empty array instead of null
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+func (h *RBACHandler) CreateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+		Require2FA:  req.Require2FA,
+	}
+	if err := models.CreateRole(c.Request.Context(), h.db.Pool, &role); err != nil {
+		if errors.Is(err, models.ErrUnknownPermission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error creating role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating role"})
+		return
+	}
+
+	h.logRoleChange(c, models.ActionCreate, role)
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *RBACHandler) UpdateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	role := models.Role{
+		Name:        c.Param("name"),
+		Description: req.Description,
+		Permissions: req.Permissions,
+		Require2FA:  req.Require2FA,
+	}
+	if err := models.UpdateRole(c.Request.Context(), h.db.Pool, &role); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		case errors.Is(err, models.ErrUnknownPermission):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error updating role: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role"})
+		}
+		return
+	}
+
+	h.logRoleChange(c, models.ActionUpdate, role)
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RBACHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	if err := models.DeleteRole(c.Request.Context(), h.db.Pool, name); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		case errors.Is(err, models.ErrRoleInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error deleting role: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting role"})
+		}
+		return
+	}
+
+	h.logRoleChange(c, models.ActionDelete, models.Role{Name: name})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *RBACHandler) logRoleChange(c *gin.Context, action string, role models.Role) {
+	if id, exists := c.Get("userID"); exists {
+		userID := id.(uint64)
+		h.publisher.LogUserAction(c.Request.Context(), userID, action, models.ResourceRole, role.Name, map[string]interface{}{
+			"description": role.Description,
+			"permissions": role.Permissions,
+			"require_2fa": role.Require2FA,
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListSessions returns the caller's active sessions.
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	h.respondSessions(c, uint(userID.(uint64)))
+}
+
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	h.revokeSession(c, uint(userID.(uint64)), c.Param("id"))
+}
+
+// RevokeAllSessions signs the caller out everywhere, or everywhere else when
+// except_current=true.
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	exceptID := ""
+	if c.Query("except_current") == "true" {
+		exceptID = c.GetString("sessionID")
+	}
+	h.revokeAllSessions(c, uint(userID.(uint64)), exceptID)
+}
+
+// ListUserSessions returns the active sessions of a user in the admin's organization.
+func (h *AuthHandler) ListUserSessions(c *gin.Context) {
+	targetID, ok := h.orgUserID(c)
+	if !ok {
+		return
+	}
+	h.respondSessions(c, targetID)
+}
+
+func (h *AuthHandler) RevokeUserSession(c *gin.Context) {
+	targetID, ok := h.orgUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeSession(c, targetID, c.Param("sessionID"))
+}
+
+func (h *AuthHandler) RevokeAllUserSessions(c *gin.Context) {
+	targetID, ok := h.orgUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeAllSessions(c, targetID, "")
+}
+
+func (h *AuthHandler) respondSessions(c *gin.Context, userID uint) {
+	sessions, err := models.GetUserSessions(c.Request.Context(), h.db.Pool, userID)
+	if err != nil {
+		log.Printf("Error fetching sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching sessions"})
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{} // Return empty array instead of null
+	}
+
+	currentID := c.GetString("sessionID")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *AuthHandler) revokeSession(c *gin.Context, userID uint, sessionID string) {
+	if err := models.RevokeSession(c.Request.Context(), h.db.Pool, userID, sessionID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Printf("Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+		return
+	}
+
+	actorID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), actorID.(uint64), models.ActionRevoke, models.ResourceSession, sessionID, map[string]interface{}{
+		"user_id": userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) revokeAllSessions(c *gin.Context, userID uint, exceptID string) {
+	revoked, err := models.RevokeUserSessions(c.Request.Context(), h.db.Pool, userID, exceptID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+
+	actorID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), actorID.(uint64), models.ActionRevoke, models.ResourceSession, "*", map[string]interface{}{
+		"user_id": userID,
+		"count":   revoked,
+		"kept":    exceptID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "revoked": revoked})
+}
+
+// orgUserID parses the :id user parameter and checks the user belongs to the
+// caller's organization.
+func (h *AuthHandler) orgUserID(c *gin.Context) (uint, bool) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+
+	orgID, _ := c.Get("orgID")
+	if _, err := models.GetMembership(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), uint(targetID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return 0, false
+	}
+	return uint(targetID), true
+}
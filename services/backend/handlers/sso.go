@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+
+	// oidcStateCookie carries the login state in the browser that started the
+	// login, so a callback URL from someone else's login is refused
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/auth/oidc"
+)
+
+// SSOHandler signs users in through OpenID Connect providers.
+type SSOHandler struct {
+	auth      *AuthHandler
+	providers map[string]*auth.OIDCProvider
+}
+
+func NewSSOHandler(authHandler *AuthHandler, providers map[string]*auth.OIDCProvider) *SSOHandler {
+	return &SSOHandler{
+		auth:      authHandler,
+		providers: providers,
+	}
+}
+
+func (h *SSOHandler) ListProviders(c *gin.Context) {
+	names := []string{}
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// Login redirects the browser to the provider's authorization endpoint.
+func (h *SSOHandler) Login(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+
+	state, nonce, err := auth.GenerateOIDCState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+	verifier, challenge, err := auth.GeneratePKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+
+	err = models.CreateOIDCLoginState(c.Request.Context(), h.auth.db.Pool, &models.OIDCLoginState{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		log.Printf("Error storing OIDC login state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+
+	redirectURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("Error building OIDC authorization URL: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), oidcCookiePath, "", secureRequest(c), true)
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// Callback completes the authorization code flow and responds like the
+// password login: either a token or a 2FA challenge.
+func (h *SSOHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed", "details": errCode})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code or state"})
+		return
+	}
+
+	// The state must come back to the browser it was issued to
+	cookieState, err := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", secureRequest(c), true)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	loginState, err := models.ConsumeOIDCLoginState(c.Request.Context(), h.auth.db.Pool, provider.Name(), state)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("Error completing OIDC login with %s: %v", provider.Name(), err)
+		h.auth.publisher.TrackLogin(c.Request.Context(), 0, false, models.Properties{
+			"provider": provider.Name(),
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with identity provider failed"})
+		return
+	}
+
+	user, err := h.resolveUser(c.Request.Context(), provider.Name(), identity)
+	if err != nil {
+		if errors.Is(err, errUnverifiedEmail) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errUnverifiedAccount) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error resolving OIDC user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error signing in"})
+		return
+	}
+
+	if err := models.TouchIdentity(c.Request.Context(), h.auth.db.Pool, provider.Name(), identity.Subject); err != nil {
+		log.Printf("Error updating identity: %v", err)
+	}
+
+	orgID, err := models.GetDefaultOrganizationID(c.Request.Context(), h.auth.db.Pool, user.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to any organization"})
+		return
+	}
+
+	h.auth.startSession(c, user, orgID)
+}
+
+var (
+	errUnverifiedEmail   = errors.New("identity provider did not verify the email address")
+	errUnverifiedAccount = errors.New("an account with this email exists but its email is not verified; verify it and sign in with your password first")
+)
+
+// secureRequest reports whether the request reached us over HTTPS, directly
+// or through a proxy.
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// resolveUser finds the user linked to the identity, links an existing account
+// with the same verified email, or provisions a new account. Unverified local
+// accounts are not linked: whoever registered one may not own the email, and
+// linking would hand them the SSO user's account.
+func (h *SSOHandler) resolveUser(ctx context.Context, provider string, identity *auth.OIDCIdentity) (*models.User, error) {
+	pool := h.auth.db.Pool
+
+	userID, err := models.GetUserIDByIdentity(ctx, pool, provider, identity.Subject)
+	if err == nil {
+		return models.GetUserByID(ctx, pool, userID)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// Only a verified email may be used to link or create an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err := models.GetUserByEmail(ctx, pool, identity.Email)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			return nil, errUnverifiedAccount
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		user, err = h.provisionUser(ctx, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = models.LinkIdentity(ctx, pool, &models.UserIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = h.auth.userOrgContext(ctx, user.ID)
+	h.auth.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionLinkIdentity, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"provider": provider,
+		"subject":  identity.Subject,
+		"email":    identity.Email,
+	})
+
+	user.Password = ""
+	return user, nil
+}
+
+// provisionUser creates a verified account with an unusable password and a
+// personal organization for a first-time SSO login.
+func (h *SSOHandler) provisionUser(ctx context.Context, email string) (*models.User, error) {
+	pool := h.auth.db.Pool
+
+	// Nobody knows this password; the account signs in through SSO or a reset
+	password, _, err := auth.GenerateActionToken("sso_placeholder")
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{Email: email, Password: password, Role: "user"}
+	if err := models.CreateUser(ctx, pool, &user); err != nil {
+		return nil, err
+	}
+	if err := models.MarkEmailVerified(ctx, pool, user.ID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+
+	org := models.Organization{Name: user.Email}
+	if err := models.CreateOrganization(ctx, pool, &org, user.ID); err != nil {
+		return nil, err
+	}
+
+	ctx = events.WithOrgID(ctx, uint64(org.ID))
+	h.auth.publisher.TrackRegistration(ctx, uint64(user.ID), models.Properties{
+		"email":  user.Email,
+		"role":   user.Role,
+		"method": "sso",
+	})
+	h.auth.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionCreate, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"email":  user.Email,
+		"role":   user.Role,
+		"method": "sso",
+	})
+
+	return &user, nil
+}
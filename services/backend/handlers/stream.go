@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamKeepAlive keeps proxies from closing idle streams.
+	streamKeepAlive = 25 * time.Second
+	// maxStreamDuration ends streams periodically so clients reconnect and
+	// revoked sessions or permissions take effect.
+	maxStreamDuration = time.Hour
+)
+
+// streamPermissions maps each stream type to the permission required to see it.
+var streamPermissions = map[string]string{
+	events.StreamAnalytics: models.PermissionAnalyticsRead,
+	events.StreamAudit:     models.PermissionAuditRead,
+}
+
+type StreamHandler struct {
+	hub *events.Hub
+}
+
+func NewStreamHandler(hub *events.Hub) *StreamHandler {
+	return &StreamHandler{hub: hub}
+}
+
+// queryList splits a comma-separated query parameter into a set.
+func queryList(c *gin.Context, name string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range strings.Split(c.Query(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// Stream pushes live analytics events and audit logs of the caller's
+// organization as server-sent events. types selects analytics and/or audit
+// (default: every type the caller may read), event matches analytics event
+// names or audit actions, and user_id and resource narrow further.
+func (h *StreamHandler) Stream(c *gin.Context) {
+	permissions, _ := c.Get("permissions")
+	granted := map[string]bool{}
+	for _, p := range permissions.([]string) {
+		granted[p] = true
+	}
+
+	types := queryList(c, "types")
+	if len(types) == 0 {
+		for t, p := range streamPermissions {
+			if granted[p] {
+				types[t] = true
+			}
+		}
+		if len(types) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+	}
+	for t := range types {
+		p, ok := streamPermissions[t]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown stream type: " + t})
+			return
+		}
+		if !granted[p] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for " + t + " events"})
+			return
+		}
+	}
+
+	orgID, _ := c.Get("orgID")
+	filter := events.StreamFilter{
+		OrgID:     orgID.(uint64),
+		Types:     types,
+		Names:     queryList(c, "event"),
+		Resources: queryList(c, "resource"),
+	}
+	if v := c.Query("user_id"); v != "" {
+		uid, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = uid
+	}
+
+	sub := h.hub.Subscribe(filter)
+	defer h.hub.Unsubscribe(sub)
+
+	// Set before the first event so request tracking sees a stream even if
+	// the client leaves early
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	deadline := time.NewTimer(maxStreamDuration)
+	defer deadline.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-sub.C:
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-keepAlive.C:
+			c.SSEvent("ping", "")
+			return true
+		case <-deadline.C:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
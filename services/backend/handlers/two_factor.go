@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	totpIssuer        = "Go Hyper"
+	recoveryCodeCount = 10
+)
+
+// SetupTwoFactor generates a new TOTP secret awaiting confirmation.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating secret"})
+		return
+	}
+
+	if err := models.SetPendingTOTPSecret(c.Request.Context(), h.db.Pool, user.ID, secret); err != nil {
+		if errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error storing TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting up two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator works,
+// returning recovery codes and a token that satisfies role enforcement.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	state, err := models.GetTOTPState(c.Request.Context(), h.db.Pool, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading two-factor state"})
+		return
+	}
+	if state.EnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrTOTPAlreadyEnabled.Error()})
+		return
+	}
+	if state.Secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(state.Secret, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := models.EnableTOTP(c.Request.Context(), h.db.Pool, user.ID, step); err != nil {
+		log.Printf("Error enabling TOTP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enabling two-factor authentication"})
+		return
+	}
+
+	codes, err := h.issueRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	token, err := reissueToken(c, h.db, *user, uint(orgID.(uint64)), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), uint64(user.ID), models.ActionEnableTwoFactor, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes, "token": token})
+}
+
+// DisableTwoFactor turns 2FA off after re-authenticating with password and code.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if c.GetBool("mfaRequired") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+
+	if _, err := models.ValidateUserCredentials(c.Request.Context(), h.db.Pool, user.Email, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if err := h.verifySecondFactor(c.Request.Context(), user.ID, req.Code, ""); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := models.DisableTOTP(c.Request.Context(), h.db.Pool, user.ID); err != nil {
+		log.Printf("Error disabling TOTP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling two-factor authentication"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), uint64(user.ID), models.ActionDisableTwoFactor, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a TOTP code.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := h.verifySecondFactor(c.Request.Context(), user.ID, req.Code, ""); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := h.issueRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), uint64(user.ID), models.ActionRegenerateRecoveryCodes, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyTwoFactor completes a two-step login with a TOTP or recovery code.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	claims, err := auth.ValidateChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), h.db.Pool, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	accountKey := accountThrottleKey(user.Email)
+	ipKey := c.ClientIP()
+	if wait := h.loginRetryAfter(c.Request.Context(), accountKey, ipKey); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
+	ctx := events.WithOrgID(c.Request.Context(), uint64(claims.OrgID))
+	if err := h.verifySecondFactor(ctx, user.ID, req.Code, req.RecoveryCode); err != nil {
+		h.recordLoginFailure(c, accountKey, ipKey)
+		h.publisher.TrackLogin(ctx, uint64(user.ID), false, models.Properties{
+			"email": user.Email,
+			"error": "invalid second factor",
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		h.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionUseRecoveryCode, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), nil)
+	}
+
+	h.completeLogin(c, user, claims.OrgID, true)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, userID uint, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		hash := auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode))
+		return models.ConsumeRecoveryCode(ctx, h.db.Pool, userID, hash)
+	}
+
+	state, err := models.GetTOTPState(ctx, h.db.Pool, userID)
+	if err != nil {
+		return err
+	}
+	if state.EnabledAt == nil {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	step, valid := auth.ValidateTOTP(state.Secret, code, time.Now())
+	if !valid {
+		return errors.New("invalid code")
+	}
+	return models.UseTOTPStep(ctx, h.db.Pool, userID, step)
+}
+
+func (h *AuthHandler) issueRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+
+	if err := models.ReplaceRecoveryCodes(ctx, h.db.Pool, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUser loads the authenticated user, responding with an error if missing.
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	id, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), h.db.Pool, uint(id.(uint64)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading user"})
+		}
+		return nil, false
+	}
+	return user, true
+}
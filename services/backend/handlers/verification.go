@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/auth"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, err := h.consumeToken(c.Request.Context(), auth.TokenPurposeEmailVerification, req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := models.MarkEmailVerified(c.Request.Context(), h.db.Pool, userID); err != nil {
+		log.Printf("Error marking email verified: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+		return
+	}
+
+	ctx := h.userOrgContext(c.Request.Context(), userID)
+	h.publisher.LogUserAction(ctx, uint64(userID), models.ActionVerifyEmail, models.ResourceUser, strconv.FormatUint(uint64(userID), 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// Respond the same way whether or not the account exists
+	user, err := models.GetUserByEmail(c.Request.Context(), h.db.Pool, req.Email)
+	if err == nil && user.EmailVerifiedAt == nil {
+		if err := h.sendVerificationEmail(h.userOrgContext(c.Request.Context(), user.ID), user); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// Respond the same way whether or not the account exists
+	user, err := models.GetUserByEmail(c.Request.Context(), h.db.Pool, req.Email)
+	if err == nil {
+		ctx := h.userOrgContext(c.Request.Context(), user.ID)
+		if err := h.sendPasswordResetEmail(ctx, user); err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		} else {
+			h.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionRequestPasswordReset, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+				"ip_address": c.ClientIP(),
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// Checked before the token is consumed so a rejected password can be retried
+	if err := h.passwordPolicy.Check(req.Password, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.consumeToken(c.Request.Context(), auth.TokenPurposePasswordReset, req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := models.UpdateUserPassword(c.Request.Context(), h.db.Pool, userID, req.Password); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+
+	// Whoever knew the old password is signed out
+	revoked, err := models.RevokeUserSessions(c.Request.Context(), h.db.Pool, userID, "")
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+	}
+
+	ctx := h.userOrgContext(c.Request.Context(), userID)
+	h.publisher.LogUserAction(ctx, uint64(userID), models.ActionResetPassword, models.ResourceUser, strconv.FormatUint(uint64(userID), 10), map[string]interface{}{
+		"ip_address":       c.ClientIP(),
+		"sessions_revoked": revoked,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	link, err := h.issueActionLink(ctx, user.ID, auth.TokenPurposeEmailVerification, emailVerificationTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Confirm your email address by opening the link below:\n\n%s\n\nThe link expires in 24 hours.\n", link),
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.publisher.LogUserAction(ctx, uint64(user.ID), models.ActionSendVerification, models.ResourceUser, strconv.FormatUint(uint64(user.ID), 10), nil)
+}
+
+func (h *AuthHandler) sendPasswordResetEmail(ctx context.Context, user *models.User) error {
+	link, err := h.issueActionLink(ctx, user.ID, auth.TokenPurposePasswordReset, passwordResetTTL, "/reset-password")
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Reset your password by opening the link below:\n\n%s\n\nThe link expires in 1 hour. If you did not request a reset, ignore this email.\n", link),
+	})
+}
+
+func (h *AuthHandler) issueActionLink(ctx context.Context, userID uint, purpose string, ttl time.Duration, path string) (string, error) {
+	token, hash, err := auth.GenerateActionToken(purpose)
+	if err != nil {
+		return "", err
+	}
+
+	if err := models.CreateUserToken(ctx, h.db.Pool, userID, purpose, hash, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+
+	return h.appURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+func (h *AuthHandler) consumeToken(ctx context.Context, purpose, token string) (uint, error) {
+	hash, err := auth.VerifyActionToken(purpose, token)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := models.ConsumeUserToken(ctx, h.db.Pool, purpose, hash)
+	if err != nil && !errors.Is(err, models.ErrTokenInvalid) {
+		log.Printf("Error consuming %s token: %v", purpose, err)
+	}
+	return userID, err
+}
+
+// userOrgContext stamps events for unauthenticated flows with the user's default organization.
+func (h *AuthHandler) userOrgContext(ctx context.Context, userID uint) context.Context {
+	orgID, err := models.GetDefaultOrganizationID(ctx, h.db.Pool, userID)
+	if err != nil {
+		return ctx
+	}
+	return events.WithOrgID(ctx, uint64(orgID))
+}
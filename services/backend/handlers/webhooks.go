@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// testEventType is the event type of deliveries sent by TestWebhook.
+const testEventType = "webhook.test"
+
+// maxWebhookDeliveries bounds the delivery log returned at once.
+const maxWebhookDeliveries = 200
+
+type WebhookHandler struct {
+	db         *database.Database
+	publisher  *events.Publisher
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(db *database.Database, publisher *events.Publisher, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		db:         db,
+		publisher:  publisher,
+		dispatcher: dispatcher,
+	}
+}
+
+type webhookRequest struct {
+	URL         *string   `json:"url"`
+	Description *string   `json:"description"`
+	EventTypes  *[]string `json:"event_types"`
+	Enabled     *bool     `json:"enabled"`
+}
+
+// apply copies the fields present in the request onto hook and reports a
+// validation error message, if any.
+func (req webhookRequest) apply(hook *models.Webhook) string {
+	if req.URL != nil {
+		hook.URL = *req.URL
+	}
+	if req.Description != nil {
+		hook.Description = *req.Description
+	}
+	if req.EventTypes != nil {
+		hook.EventTypes = *req.EventTypes
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+
+	if !webhooks.ValidURL(hook.URL) {
+		return "url must be an absolute http or https URL"
+	}
+	if len(hook.EventTypes) == 0 {
+		return "event_types must list at least one event type"
+	}
+	return ""
+}
+
+// webhookFromParam loads the :id webhook of the caller's organization,
+// including its secret, and writes the error response if it cannot.
+func (h *WebhookHandler) webhookFromParam(c *gin.Context) (*models.Webhook, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	orgID, _ := c.Get("orgID")
+	hook, err := models.GetWebhook(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error fetching webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhook"})
+		return nil, false
+	}
+	return hook, true
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+	hooks, err := models.GetOrgWebhooks(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)))
+	if err != nil {
+		log.Printf("Error fetching webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// CreateWebhook subscribes a URL to the organization's events. The signing
+// secret is only returned in this response.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+	createdBy := uint(userID.(uint64))
+	hook := models.Webhook{OrgID: uint(orgID.(uint64)), Enabled: true, CreatedBy: &createdBy}
+	if msg := req.apply(&hook); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating webhook secret"})
+		return
+	}
+	hook.Secret = secret
+
+	if err := models.CreateWebhook(c.Request.Context(), h.db.Pool, &hook); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+		return
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionCreate, models.ResourceWebhook, strconv.FormatUint(uint64(hook.ID), 10), map[string]interface{}{
+		"url":         hook.URL,
+		"event_types": hook.EventTypes,
+	})
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// UpdateWebhook changes the URL, description or event types, or enables and
+// disables the webhook. Omitted fields are left unchanged.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	hook, ok := h.webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if msg := req.apply(hook); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := models.UpdateWebhook(c.Request.Context(), h.db.Pool, hook); err != nil {
+		log.Printf("Error updating webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating webhook"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionUpdate, models.ResourceWebhook, strconv.FormatUint(uint64(hook.ID), 10), map[string]interface{}{
+		"url":         hook.URL,
+		"event_types": hook.EventTypes,
+		"enabled":     hook.Enabled,
+	})
+
+	hook.Secret = ""
+	c.JSON(http.StatusOK, hook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	orgID, _ := c.Get("orgID")
+	if err := models.DeleteWebhook(c.Request.Context(), h.db.Pool, uint(orgID.(uint64)), uint(id)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		log.Printf("Error deleting webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionDelete, models.ResourceWebhook, strconv.FormatUint(id, 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// TestWebhook sends a signed webhook.test event right away, even to a disabled
+// webhook, and returns the endpoint's response. The attempt is logged with
+// the webhook's deliveries but not retried.
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	hook, ok := h.webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	payload, _ := json.Marshal(gin.H{
+		"message":      "This is a test delivery.",
+		"webhook_id":   hook.ID,
+		"requested_by": userID,
+		"timestamp":    time.Now(),
+	})
+	delivery := models.WebhookDelivery{WebhookID: hook.ID, EventType: testEventType, Payload: payload, Status: models.WebhookDeliveryFailed}
+	if err := models.CreateWebhookDelivery(c.Request.Context(), h.db.Pool, &delivery); err != nil {
+		log.Printf("Error creating test delivery: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending test delivery"})
+		return
+	}
+
+	result := h.dispatcher.Send(c.Request.Context(), *hook, delivery)
+	status := models.WebhookDeliverySucceeded
+	if result.Error != "" {
+		status = models.WebhookDeliveryFailed
+	}
+	var responseStatus *int
+	if result.StatusCode != 0 {
+		responseStatus = &result.StatusCode
+	}
+	if err := models.RecordWebhookAttempt(c.Request.Context(), h.db.Pool, delivery.ID, status, responseStatus, result.Error, time.Now()); err != nil {
+		log.Printf("Error recording test delivery: %v", err)
+	}
+
+	h.publisher.LogUserAction(c.Request.Context(), userID.(uint64), models.ActionTest, models.ResourceWebhook, strconv.FormatUint(uint64(hook.ID), 10), map[string]interface{}{
+		"status": status,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"delivery_id": delivery.ID, "status": status, "result": result})
+}
+
+// ListDeliveries returns the webhook's most recent deliveries, newest first.
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	hook, ok := h.webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWebhookDeliveries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxWebhookDeliveries)})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(c.Request.Context(), h.db.Pool, hook.ID, limit)
+	if err != nil {
+		log.Printf("Error fetching webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -6,10 +6,15 @@ import (
 	"os"
 	"time"
 
+	"go-turbo/pkg/auth"
 	"go-turbo/pkg/database"
 	"go-turbo/pkg/database/clickhouse"
 	"go-turbo/pkg/events"
+	"go-turbo/pkg/mailer"
+	"go-turbo/pkg/models"
+	"go-turbo/pkg/password"
 	"go-turbo/pkg/queue"
+	"go-turbo/pkg/webhooks"
 	"go-turbo/services/backend/handlers"
 	"go-turbo/services/backend/middleware"
 
@@ -59,17 +64,24 @@ func main() {
 	}
 	defer clickhouseClient.Close()
 
-	// Create ClickHouse tables
+	// Tables are created by make migrate-up
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := clickhouseClient.CreateAnalyticsTable(ctx); err != nil {
-		logger.Fatal("Failed to create analytics table", zap.Error(err))
+	if err := clickhouseClient.CheckMigrated(ctx); err != nil {
+		logger.Fatal("ClickHouse schema not ready", zap.Error(err))
 	}
-	if err := clickhouseClient.CreateAuditLogsTable(ctx); err != nil {
-		logger.Fatal("Failed to create audit logs table", zap.Error(err))
+
+	// Background data export and erasure jobs do not survive a restart
+	if interrupted, err := models.FailInterruptedDataRequests(ctx, db.Pool); err != nil {
+		logger.Error("Failed to clean up interrupted data requests", zap.Error(err))
+	} else if interrupted > 0 {
+		logger.Warn("Marked interrupted data requests as failed", zap.Int64("count", interrupted))
 	}
 
+	// Expired and revoked sessions are removed after a week
+	go cleanupSessions(context.Background(), db, logger)
+
 	// Initialize RabbitMQ
 	rabbitmq, err := queue.NewRabbitMQ(os.Getenv("RABBITMQ_URL"))
 	if err != nil {
@@ -77,13 +89,32 @@ func main() {
 	}
 	defer rabbitmq.Close()
 
-	// Declare required queues
-	if err := rabbitmq.DeclareQueue("analytics_queue"); err != nil {
-		logger.Fatal("Failed to declare analytics queue", zap.Error(err))
+	// Declare the events exchange and storage queues
+	if err := events.DeclareTopology(rabbitmq); err != nil {
+		logger.Fatal("Failed to declare event queues", zap.Error(err))
 	}
-	if err := rabbitmq.DeclareQueue("audit_logs_queue"); err != nil {
-		logger.Fatal("Failed to declare audit logs queue", zap.Error(err))
+
+	// Fan live events out to streaming clients
+	liveEvents, err := rabbitmq.Subscribe(events.Exchange, "#")
+	if err != nil {
+		logger.Fatal("Failed to subscribe to live events", zap.Error(err))
 	}
+	hub := events.NewHub()
+	go hub.Run(liveEvents)
+
+	appMailer := mailer.NewFromEnv()
+
+	// Queue and send outbound webhook deliveries
+	dispatcher := webhooks.NewDispatcher(db, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true")
+	if err := webhooks.DeclareQueue(rabbitmq); err != nil {
+		logger.Fatal("Failed to declare webhook queue", zap.Error(err))
+	}
+	webhookEvents, err := rabbitmq.Consume(webhooks.Queue)
+	if err != nil {
+		logger.Fatal("Failed to consume webhook queue", zap.Error(err))
+	}
+	go dispatcher.Run(context.Background(), webhookEvents)
+	go dispatcher.RunWorker(context.Background())
 
 	// Initialize event publisher
 	publisher := events.NewPublisher(rabbitmq)
@@ -102,10 +133,34 @@ func main() {
 	}))
 
 	// Initialize handlers and middleware
-	authHandler := handlers.NewAuthHandler(db, publisher)
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:5173"
+	}
+	passwordPolicy, err := password.PolicyFromEnv()
+	if err != nil {
+		logger.Fatal("Failed to load password policy", zap.Error(err))
+	}
+	authHandler := handlers.NewAuthHandler(db, publisher, appMailer, passwordPolicy, appURL)
 	analyticsHandler := handlers.NewAnalyticsHandler(clickhouseClient)
 	auditHandler := handlers.NewAuditHandler(clickhouseClient)
-	authMiddleware := middleware.NewAuthMiddleware(db)
+	streamHandler := handlers.NewStreamHandler(hub)
+	ssoHandler := handlers.NewSSOHandler(authHandler, auth.OIDCProvidersFromEnv())
+	rbacHandler := handlers.NewRBACHandler(db, publisher)
+	orgHandler := handlers.NewOrganizationHandler(db, publisher, appMailer, appURL)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db, publisher)
+	webhookHandler := handlers.NewWebhookHandler(db, publisher, dispatcher)
+	eventSchemaHandler := handlers.NewEventSchemaHandler(db, clickhouseClient, publisher)
+	exportDir := os.Getenv("DATA_EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "tmp/exports"
+	}
+	privacyHandler := handlers.NewPrivacyHandler(authHandler, clickhouseClient, exportDir)
+
+	// Personal data exports are deleted once they can no longer be downloaded
+	go cleanupExports(context.Background(), privacyHandler, logger)
+
+	authMiddleware := middleware.NewAuthMiddleware(db, publisher)
 	analyticsMiddleware := middleware.NewAnalyticsMiddleware(publisher)
 
 	// Add analytics tracking middleware
@@ -114,35 +169,149 @@ func main() {
 	// Public routes
 	r.POST("/api/auth/login", authHandler.Login)
 	r.POST("/api/auth/register", authHandler.Register)
+	r.POST("/api/auth/verify-email", authHandler.VerifyEmail)
+	r.POST("/api/auth/resend-verification", authHandler.ResendVerification)
+	r.POST("/api/auth/request-password-reset", authHandler.RequestPasswordReset)
+	r.POST("/api/auth/reset-password", authHandler.ResetPassword)
+	r.POST("/api/auth/confirm-email-change", authHandler.ConfirmEmailChange)
+	r.POST("/api/auth/2fa/verify", authHandler.VerifyTwoFactor)
+
+	// Single sign-on
+	r.GET("/api/auth/oidc/providers", ssoHandler.ListProviders)
+	r.GET("/api/auth/oidc/:provider/login", ssoHandler.Login)
+	r.GET("/api/auth/oidc/:provider/callback", ssoHandler.Callback)
+
+	// Two-factor enrollment stays reachable for users whose role enforces 2FA
+	twoFactor := r.Group("/api/user/2fa")
+	twoFactor.Use(authMiddleware.RequireAuth())
+	{
+		twoFactor.POST("/setup", authHandler.SetupTwoFactor)
+		twoFactor.POST("/confirm", authHandler.ConfirmTwoFactor)
+		twoFactor.POST("/disable", authHandler.DisableTwoFactor)
+		twoFactor.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+	}
 
 	// Protected routes
 	authorized := r.Group("/api")
-	authorized.Use(authMiddleware.RequireAuth())
+	authorized.Use(authMiddleware.RequireAuth(), authMiddleware.RequireMFAEnrollment())
 	{
 		// Add page view tracking for authenticated routes
 		authorized.Use(analyticsMiddleware.TrackPageView())
 
 		// Admin routes
 		admin := authorized.Group("/admin")
-		admin.Use(authMiddleware.RequireRole([]string{"admin"}))
 		{
-			admin.GET("/users", authHandler.GetUsers)
+			admin.GET("/users", authMiddleware.RequirePermission(models.PermissionUsersRead), authHandler.GetUsers)
+			admin.POST("/users/:id/unlock", authMiddleware.RequirePermission(models.PermissionUsersWrite), authHandler.UnlockUser)
+			admin.GET("/users/:id/sessions", authMiddleware.RequirePermission(models.PermissionUsersRead), authHandler.ListUserSessions)
+			admin.DELETE("/users/:id/sessions", authMiddleware.RequirePermission(models.PermissionUsersWrite), authHandler.RevokeAllUserSessions)
+			admin.DELETE("/users/:id/sessions/:sessionID", authMiddleware.RequirePermission(models.PermissionUsersWrite), authHandler.RevokeUserSession)
+			admin.POST("/users/:id/erase", authMiddleware.RequirePermission(models.PermissionUsersWrite), privacyHandler.EraseUser)
+			admin.GET("/data-requests/:id", authMiddleware.RequirePermission(models.PermissionUsersWrite), privacyHandler.GetDataRequest)
+
+			// Role management
+			admin.GET("/roles", authMiddleware.RequirePermission(models.PermissionRolesRead), rbacHandler.ListRoles)
+			admin.GET("/roles/:name", authMiddleware.RequirePermission(models.PermissionRolesRead), rbacHandler.GetRole)
+			admin.GET("/permissions", authMiddleware.RequirePermission(models.PermissionRolesRead), rbacHandler.ListPermissions)
+
+			// Outbound webhooks
+			admin.GET("/webhooks", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.ListWebhooks)
+			admin.POST("/webhooks", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.CreateWebhook)
+			admin.PATCH("/webhooks/:id", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.UpdateWebhook)
+			admin.DELETE("/webhooks/:id", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.DeleteWebhook)
+			admin.POST("/webhooks/:id/test", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.TestWebhook)
+			admin.GET("/webhooks/:id/deliveries", authMiddleware.RequirePermission(models.PermissionWebhooksManage), webhookHandler.ListDeliveries)
+
+			// Analytics event schemas and validation
+			admin.GET("/event-schemas", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.ListSchemas)
+			admin.GET("/event-schemas/:event", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.GetSchema)
+			admin.PUT("/event-schemas/:event", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.PutSchema)
+			admin.DELETE("/event-schemas/:event", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.DeleteSchema)
+			admin.GET("/event-validation", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.GetValidationMode)
+			admin.PUT("/event-validation", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.SetValidationMode)
+			admin.GET("/event-quarantine", authMiddleware.RequirePermission(models.PermissionSchemasManage), eventSchemaHandler.ListQuarantine)
+		}
+
+		// Platform operator routes, across all organizations
+		platform := authorized.Group("/platform")
+		platform.Use(authMiddleware.RequirePlatformOperator())
+		{
+			platform.POST("/users/:id/erase", privacyHandler.EraseAccount)
+
+			// Role definitions are shared by every organization
+			platform.POST("/roles", rbacHandler.CreateRole)
+			platform.PUT("/roles/:name", rbacHandler.UpdateRole)
+			platform.DELETE("/roles/:name", rbacHandler.DeleteRole)
 		}
 
 		// User routes
 		user := authorized.Group("/user")
 		{
 			user.GET("/profile", authHandler.GetProfile)
+			user.PATCH("/profile", authHandler.UpdateProfile)
+			user.POST("/password", authHandler.ChangePassword)
+
+			// Signed-in sessions
+			user.GET("/sessions", authHandler.ListSessions)
+			user.DELETE("/sessions", authHandler.RevokeAllSessions)
+			user.DELETE("/sessions/:id", authHandler.RevokeSession)
+
+			// Personal data export and account erasure
+			user.POST("/data-exports", privacyHandler.RequestExport)
+			user.GET("/data-exports", privacyHandler.ListExports)
+			user.GET("/data-exports/:id/download", privacyHandler.DownloadExport)
+			user.POST("/erasure", privacyHandler.RequestErasure)
+
+			// Invitations to join organizations
+			user.GET("/invitations", orgHandler.ListMyInvitations)
+			user.POST("/invitations/:id/accept", orgHandler.AcceptInvitation)
+			user.DELETE("/invitations/:id", orgHandler.DeclineInvitation)
+
+			// Personal API keys
+			user.GET("/api-keys", apiKeyHandler.ListKeys)
+			user.POST("/api-keys", apiKeyHandler.CreateKey)
+			user.DELETE("/api-keys/:id", apiKeyHandler.RevokeKey)
+		}
+
+		// Organization routes
+		orgs := authorized.Group("/orgs")
+		{
+			orgs.GET("", orgHandler.ListOrganizations)
+			orgs.POST("", orgHandler.CreateOrganization)
+			orgs.POST("/:id/switch", orgHandler.SwitchOrganization)
+			orgs.GET("/:id/members", orgHandler.ListMembers)
+			orgs.PATCH("/:id/members/:userID", orgHandler.UpdateMember)
+			orgs.DELETE("/:id/members/:userID", orgHandler.RemoveMember)
+			orgs.GET("/:id/invitations", orgHandler.ListInvitations)
+			orgs.POST("/:id/invitations", orgHandler.InviteMember)
+			orgs.DELETE("/:id/invitations/:userID", orgHandler.CancelInvitation)
 		}
 
 		// Analytics routes
 		analytics := authorized.Group("/analytics")
+		analytics.Use(authMiddleware.RequirePermission(models.PermissionAnalyticsRead))
 		{
 			analytics.GET("/events", analyticsHandler.GetEvents)
+			analytics.GET("/events/hourly", analyticsHandler.GetHourlyEventCounts)
+			analytics.GET("/active-users", analyticsHandler.GetDailyActiveUsers)
+			analytics.GET("/latency", analyticsHandler.GetEndpointLatency)
+			analytics.GET("/latency/route", analyticsHandler.GetRouteLatency)
+			analytics.POST("/funnel", analyticsHandler.GetFunnel)
+			analytics.GET("/retention", analyticsHandler.GetRetention)
+			analytics.GET("/sessions", analyticsHandler.ListSessions)
+			analytics.GET("/sessions/summary", analyticsHandler.GetSessionSummary)
+			analytics.GET("/sessions/:sessionID", analyticsHandler.GetSessionTimeline)
+			analytics.GET("/properties/:key/stats", analyticsHandler.GetPropertyStats)
+			analytics.GET("/properties/:key/values", analyticsHandler.GetPropertyValues)
+			analytics.GET("/schemas", eventSchemaHandler.ListSchemas)
 		}
 
+		// Live analytics and audit events, filtered by the caller's permissions
+		authorized.GET("/stream", streamHandler.Stream)
+
 		// Audit routes
 		audit := authorized.Group("/audit")
+		audit.Use(authMiddleware.RequirePermission(models.PermissionAuditRead))
 		{
 			audit.GET("/logs", auditHandler.GetLogs)
 		}
@@ -159,3 +328,53 @@ func main() {
 		logger.Fatal("Failed to start server", zap.Error(err))
 	}
 }
+
+const (
+	sessionRetention       = 7 * 24 * time.Hour
+	sessionCleanupInterval = time.Hour
+	exportCleanupInterval  = time.Hour
+)
+
+// cleanupSessions periodically deletes sessions that expired or were revoked
+// more than sessionRetention ago.
+func cleanupSessions(ctx context.Context, db *database.Database, logger *zap.Logger) {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := models.DeleteStaleSessions(ctx, db.Pool, time.Now().Add(-sessionRetention))
+		if err != nil {
+			logger.Error("Failed to delete stale sessions", zap.Error(err))
+		} else if n > 0 {
+			logger.Info("Deleted stale sessions", zap.Int64("count", n))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cleanupExports periodically deletes expired data export files.
+func cleanupExports(ctx context.Context, privacyHandler *handlers.PrivacyHandler, logger *zap.Logger) {
+	ticker := time.NewTicker(exportCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := privacyHandler.DeleteExpiredExports(ctx)
+		if err != nil {
+			logger.Error("Failed to delete expired data exports", zap.Error(err))
+		}
+		if n > 0 {
+			logger.Info("Deleted expired data exports", zap.Int("count", n))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package middleware
 
 import (
+	"io"
+	"strings"
+	"time"
+
 	"go-turbo/pkg/events"
+	"go-turbo/pkg/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,14 +19,61 @@ func NewAnalyticsMiddleware(publisher *events.Publisher) *AnalyticsMiddleware {
 	return &AnalyticsMiddleware{publisher: publisher}
 }
 
+// countingBody counts the request body bytes a handler reads, for requests
+// without a Content-Length.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// TrackRequest records every authenticated request with its route template
+// (gin's FullPath, such as /api/admin/users/:id), duration and request and
+// response sizes, so latency can be compared per endpoint. Streamed responses
+// stay open for as long as the client listens, so they are recorded without a
+// duration or sizes and left out of latency reports.
 func (m *AnalyticsMiddleware) TrackRequest() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
+		body := &countingBody{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+
 		// Process request
 		c.Next()
 
 		// Get user ID if authenticated
 		if id, exists := c.Get("userID"); exists {
 			userID := id.(uint64)
+
+			requestBytes := c.Request.ContentLength
+			if requestBytes < 0 {
+				requestBytes = body.n
+			}
+			responseBytes := c.Writer.Size()
+			if responseBytes < 0 {
+				responseBytes = 0
+			}
+
+			properties := models.Properties{
+				"route":      c.FullPath(),
+				"ip_address": c.ClientIP(),
+				"user_agent": c.Request.UserAgent(),
+			}
+			if isStreaming(c) {
+				properties["streaming"] = true
+			} else {
+				properties["duration_ms"] = float64(time.Since(start).Microseconds()) / 1000
+				properties["request_bytes"] = requestBytes
+				properties["response_bytes"] = responseBytes
+			}
+
 			// Track API request
 			m.publisher.TrackAPIRequest(
 				c.Request.Context(),
@@ -29,15 +81,17 @@ func (m *AnalyticsMiddleware) TrackRequest() gin.HandlerFunc {
 				c.Request.URL.Path,
 				c.Request.Method,
 				c.Writer.Status(),
-				map[string]string{
-					"ip_address": c.ClientIP(),
-					"user_agent": c.Request.UserAgent(),
-				},
+				properties,
 			)
 		}
 	}
 }
 
+// isStreaming reports whether the response was a server-sent event stream.
+func isStreaming(c *gin.Context) bool {
+	return strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream")
+}
+
 func (m *AnalyticsMiddleware) TrackPageView() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID if authenticated
@@ -48,7 +102,7 @@ func (m *AnalyticsMiddleware) TrackPageView() gin.HandlerFunc {
 				c.Request.Context(),
 				userID,
 				c.Request.URL.Path,
-				map[string]string{
+				models.Properties{
 					"referrer":   c.Request.Referer(),
 					"ip_address": c.ClientIP(),
 					"user_agent": c.Request.UserAgent(),
@@ -1,22 +1,50 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"reflect"
+	"runtime"
 	"strings"
 
 	"go-turbo/pkg/auth"
 	"go-turbo/pkg/database"
+	"go-turbo/pkg/events"
 	"go-turbo/pkg/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthMiddleware struct {
-	db *database.Database
+	db        *database.Database
+	publisher *events.Publisher
+
+	// apiKeyAuth resolves API keys; tests replace it to avoid a database
+	apiKeyAuth func(c *gin.Context, rawKey string) (*auth.Claims, error)
 }
 
-func NewAuthMiddleware(db *database.Database) *AuthMiddleware {
-	return &AuthMiddleware{db: db}
+func NewAuthMiddleware(db *database.Database, publisher *events.Publisher) *AuthMiddleware {
+	m := &AuthMiddleware{
+		db:        db,
+		publisher: publisher,
+	}
+	m.apiKeyAuth = m.authenticateAPIKey
+	return m
+}
+
+// permissionGuard is the name gin reports for handlers made by
+// RequirePermission.
+var permissionGuard = runtime.FuncForPC(reflect.ValueOf((&AuthMiddleware{}).RequirePermission("")).Pointer()).Name()
+
+// declaresPermission reports whether the matched route is guarded by
+// RequirePermission.
+func declaresPermission(c *gin.Context) bool {
+	for _, name := range c.HandlerNames() {
+		if name == permissionGuard {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
@@ -35,45 +63,150 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := auth.ValidateJWT(bearerToken[1])
+		// Machine clients send API keys in place of a JWT
+		var claims *auth.Claims
+		var err error
+		isAPIKey := auth.IsAPIKey(bearerToken[1])
+		if isAPIKey {
+			claims, err = m.apiKeyAuth(c, bearerToken[1])
+		} else {
+			claims, err = auth.ValidateJWT(bearerToken[1])
+			if err == nil {
+				err = m.checkSession(c, claims)
+			}
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// API keys are denied by default: they only reach routes that declare
+		// a permission, which RequirePermission then checks against the
+		// key's scopes. Account routes such as 2FA, exports and organization
+		// membership need a signed-in user.
+		if isAPIKey && !declaresPermission(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this endpoint"})
+			c.Abort()
+			return
+		}
+
 		// Store user ID as uint64
 		c.Set("userID", uint64(claims.UserID))
+		c.Set("orgID", uint64(claims.OrgID))
+		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("mfa", claims.MFA)
+		c.Set("mfaRequired", claims.MFARequired)
+
+		// Stamp events published while handling this request with the caller's organization
+		c.Request = c.Request.WithContext(events.WithOrgID(c.Request.Context(), uint64(claims.OrgID)))
 		c.Next()
 	}
 }
 
+// checkSession rejects tokens whose session was revoked or has expired, and
+// tokens for an organization the user has left or whose role there changed
+// since the token was issued. It records the session as recently seen.
+func (m *AuthMiddleware) checkSession(c *gin.Context, claims *auth.Claims) error {
+	session, err := models.GetActiveSession(c.Request.Context(), m.db.Pool, claims.Id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != claims.UserID {
+		return models.ErrSessionInvalid
+	}
+
+	member, err := models.GetMembership(c.Request.Context(), m.db.Pool, claims.OrgID, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if models.MemberRole(member.Role) != claims.Role {
+		return models.ErrSessionInvalid
+	}
+
+	c.Set("sessionID", session.ID)
+	if err := models.TouchSession(c.Request.Context(), m.db.Pool, session.ID); err != nil {
+		log.Printf("Error updating session last seen: %v", err)
+	}
+	return nil
+}
+
 func (m *AuthMiddleware) RequireRole(roles []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("userID")
+		role, exists := c.Get("role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			c.Abort()
 			return
 		}
 
-		// Convert userID to uint for database query
-		user, err := models.GetUserByID(c.Request.Context(), m.db.Pool, uint(userID.(uint64)))
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		hasRole := false
+		for _, r := range roles {
+			if role.(string) == r {
+				hasRole = true
+				break
+			}
+		}
+
+		if !hasRole {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
 		}
 
-		hasRole := false
-		for _, role := range roles {
-			if user.Role == role {
-				hasRole = true
+		c.Next()
+	}
+}
+
+// RequirePermission checks the permissions embedded in the caller's token.
+func (m *AuthMiddleware) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, exists := c.Get("permissions")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		hasPermission := false
+		for _, p := range permissions.([]string) {
+			if p == permission {
+				hasPermission = true
 				break
 			}
 		}
 
-		if !hasRole {
+		if !hasPermission {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePlatformOperator limits a route to platform operators, who act on
+// accounts across all organizations. The flag is read from the database on
+// each request rather than trusted from the token.
+func (m *AuthMiddleware) RequirePlatformOperator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		operator, err := models.IsPlatformOperator(c.Request.Context(), m.db.Pool, uint(userID.(uint64)))
+		if err != nil {
+			log.Printf("Error checking platform operator: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+			c.Abort()
+			return
+		}
+		if !operator {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
@@ -82,3 +215,17 @@ func (m *AuthMiddleware) RequireRole(roles []string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireMFAEnrollment blocks tokens for users whose role enforces 2FA but who
+// have not completed a second factor. Enrollment routes must not use it.
+func (m *AuthMiddleware) RequireMFAEnrollment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("mfaRequired") && !c.GetBool("mfa") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role", "code": "mfa_enrollment_required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -20,6 +20,6 @@ type LoginRequest struct {
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required,min=10"`
 	Role     string `json:"role" binding:"required,oneof=admin client"`
 }